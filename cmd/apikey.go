@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/config"
+	"github.com/Elmar006/subscription_service/internal/db"
+	"github.com/Elmar006/subscription_service/internal/repository"
+)
+
+// runAPIKey implements the "apikey issue|list|revoke" commands.
+func runAPIKey(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("apikey: expected issue, list or revoke")
+	}
+
+	database := db.Connect(cfg)
+	defer database.Close()
+	repo := repository.NewAPIKeyRepo(database)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "issue":
+		fs := flag.NewFlagSet("apikey issue", flag.ContinueOnError)
+		name := fs.String("name", "", "key name")
+		scopes := fs.String("scopes", auth.ScopeRead, "comma separated scopes: read, write, admin")
+		ttl := fs.Duration("ttl", 0, "key lifetime, e.g. 720h (0 means no expiry)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return fmt.Errorf("apikey issue: -name is required")
+		}
+
+		scopeList := strings.Split(*scopes, ",")
+		for _, s := range scopeList {
+			if !auth.ValidScope(s) {
+				return fmt.Errorf("apikey issue: unknown scope %q", s)
+			}
+		}
+
+		plain, key, err := auth.Issue(ctx, repo, *name, scopeList, *ttl)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ID:  %s\nKey: %s\n", key.ID, plain)
+		fmt.Println("Store the key now, it cannot be shown again.")
+		return nil
+
+	case "list":
+		keys, err := repo.List(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES\tREVOKED")
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","), formatTime(k.ExpiresAt), formatTime(k.RevokedAt))
+		}
+		return tw.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("apikey revoke: expected key ID")
+		}
+		found, err := repo.Revoke(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("apikey revoke: active key %s not found", args[1])
+		}
+		fmt.Printf("Key %s revoked\n", args[1])
+		return nil
+	}
+
+	return fmt.Errorf("apikey: unknown command %q", args[0])
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -1,52 +1,301 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
 
 	_ "github.com/Elmar006/subscription_service/docs"
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/budget"
 	"github.com/Elmar006/subscription_service/internal/config"
 	"github.com/Elmar006/subscription_service/internal/db"
 	"github.com/Elmar006/subscription_service/internal/handler"
+	"github.com/Elmar006/subscription_service/internal/metrics"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/notify"
+	"github.com/Elmar006/subscription_service/internal/policy"
+	"github.com/Elmar006/subscription_service/internal/ratelimit"
+	"github.com/Elmar006/subscription_service/internal/reminder"
 	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/scheduler"
+	"github.com/Elmar006/subscription_service/internal/tracing"
+	"github.com/Elmar006/subscription_service/internal/webhook"
+	"github.com/Elmar006/subscription_service/internal/zone"
 	"github.com/Elmar006/subscription_service/logger"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
+const usage = `Usage:
+  app                                                   start the HTTP server
+  app config print                                      print the effective configuration with secrets masked
+  app apikey issue -name NAME [-scopes read,write] [-ttl 720h]   issue an API key
+  app apikey list                                       list API keys
+  app apikey revoke ID                                  revoke an API key
+`
+
 // @title Subscription Service API
 // @version 1.0
 // @description API for managing subscriptions
 // @host localhost:8080
 // @BasePath /
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 func main() {
-	cfg := config.Load()
-	logger.Init()
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	args := os.Args[1:]
+	switch {
+	case len(args) == 0:
+		serve(cfg)
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case args[0] == "apikey":
+		if err := runAPIKey(cfg, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func serve(cfg *config.Config) {
+	logger.Init(cfg.LogLevel)
 	log := logger.L()
 
+	shutdownTracing, err := tracing.Init(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	jwtVerifier, err := auth.NewJWTVerifier(cfg.JWT, cfg.DefaultRole)
+	if err != nil {
+		log.Fatalf("Failed to init JWT verification: %v", err)
+	}
+
 	database := db.Connect(cfg)
 	defer database.Close()
 
 	repo := repository.NewSubscriptionRepo(database)
-	handler := handler.NewSubscriptionHandler(repo)
+	if cfg.Feature("rls") {
+		repo = repository.NewSubscriptionRepoWithRLS(database)
+	}
+	apiKeys := repository.NewAPIKeyRepo(database)
+	orgs := repository.NewOrganizationRepo(database)
+	services := repository.NewServiceRepo(database)
+	plans := repository.NewPlanRepo(database)
+	webhooks := repository.NewWebhookRepo(database)
+	budgets := repository.NewBudgetRepo(database)
+	users := repository.NewUserRepo(database)
+	zones := zone.NewResolver(users, orgs)
+	pol, err := policy.New(cfg.Policies)
+	if err != nil {
+		log.Fatalf("Invalid policies: %v", err)
+	}
+	subHandler := handler.NewSubscriptionHandler(repo, services, plans, users, budget.NewAlerts(budgets, webhooks, zones), pol,
+		cfg.Feature("strict_duplicates"))
+	keyHandler := handler.NewAPIKeyHandler(apiKeys)
+	orgHandler := handler.NewOrganizationHandler(orgs)
+	serviceHandler := handler.NewServiceHandler(services)
+	planHandler := handler.NewPlanHandler(plans, services)
+	webhookHandler := handler.NewWebhookHandler(webhooks)
+	budgetHandler := handler.NewBudgetHandler(budgets, users, zones, pol)
+	userHandler := handler.NewUserHandler(users, repo, pol)
+
+	notifier, err := notify.New(cfg.Reminders)
+	if err != nil {
+		log.Fatalf("Invalid notifiers: %v", err)
+	}
+	sched := scheduler.New(database)
+	sched.Add("apply-price-changes", time.Hour, func(ctx context.Context) error {
+		n, err := plans.ApplyPriceChanges(ctx, time.Now())
+		if n > 0 {
+			log.Infof("Applied %d scheduled price changes", n)
+		}
+		return err
+	})
+	sched.Add("reminders", cfg.Reminders.Interval,
+		reminder.New(repo, repository.NewReminderRepo(database), zones, notifier, cfg.Reminders.DaysBefore).Job)
+	dispatcher := webhook.New(webhooks, repo, cfg.Webhooks)
+	sched.Add("charge-events", time.Hour, dispatcher.ChargesJob)
+	sched.Add("webhook-deliveries", cfg.Webhooks.Interval, dispatcher.Run)
+
+	jobs, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	go func() {
+		sched.Run(jobs)
+		close(jobsDone)
+	}()
+
+	metrics.Register(database, func() (int, map[string]model.Money, error) {
+		return repo.ActiveSummary(context.Background(), time.Now())
+	})
 
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Use(logger.RequestID)
 	r.Use(middleware.Logger)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.Recoverer)
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		r.Use(cors.Handler(cors.Options{
+			AllowedOrigins: cfg.CORS.AllowedOrigins,
+			AllowedMethods: cfg.CORS.AllowedMethods,
+			AllowedHeaders: cfg.CORS.AllowedHeaders,
+			ExposedHeaders: []string{logger.RequestIDHeader, "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+		}))
+	}
+	if cfg.RateLimit.IPPerMinute > 0 {
+		r.Use(ratelimit.NewByIP(cfg.RateLimit.IPPerMinute, cfg.RateLimit.IPBurst).Middleware)
+	}
+	r.Use(auth.Middleware(apiKeys, jwtVerifier, cfg.PublicPaths))
+	r.Use(auth.Tenant(orgs))
+	if cfg.RateLimit.RequestsPerMinute > 0 {
+		r.Use(ratelimit.New(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst).Middleware)
+	}
+	r.Use(zones.Middleware(pol))
+	expensive := func(next http.Handler) http.Handler { return next }
+	if cfg.RateLimit.ExpensivePerMinute > 0 {
+		expensive = ratelimit.New(cfg.RateLimit.ExpensivePerMinute, cfg.RateLimit.ExpensiveBurst).Middleware
+	}
+
+	read := auth.RequireScope(auth.ScopeRead)
+	write := auth.RequireScope(auth.ScopeWrite)
+	admin := auth.RequireScope(auth.ScopeAdmin)
+
+	r.With(admin).Handle("/metrics", metrics.Handler())
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("OK"))
 	})
-	r.Post("/subscriptions", handler.CreateSubscription)
-	r.Get("/subscriptions/{id}", handler.GetByIDSubscription)
-	r.Put("/subscriptions/{id}", handler.UpdateByIDSubscription)
-	r.Delete("/subscriptions/{id}", handler.DeleteSubscription)
-	r.Get("/subscriptions", handler.GetSubscription)
-	r.Get("/subscriptions/total", handler.GetSubscriptionTotal)
+	r.With(write).Post("/subscriptions", subHandler.CreateSubscription)
+	r.With(read).Get("/subscriptions/{id}", subHandler.GetByIDSubscription)
+	r.With(write).Put("/subscriptions/{id}", subHandler.UpdateByIDSubscription)
+	r.With(write).Delete("/subscriptions/{id}", subHandler.DeleteSubscription)
+	r.With(write).Post("/subscriptions/{id}/pause", subHandler.PauseSubscription)
+	r.With(write).Post("/subscriptions/{id}/resume", subHandler.ResumeSubscription)
+	r.With(write).Post("/subscriptions/{id}/cancel", subHandler.CancelSubscription)
+	r.With(read).Get("/subscriptions", subHandler.GetSubscription)
+	r.With(write).Delete("/subscriptions", subHandler.PurgeSubscriptions)
+	r.With(read, expensive).Get("/subscriptions/total", subHandler.GetSubscriptionTotal)
+	r.With(read, expensive).Get("/subscriptions/export", subHandler.ExportSubscriptions)
+	r.With(read).Get("/subscriptions/trials/ending", subHandler.GetTrialsEnding)
+	r.With(read, expensive).Get("/subscriptions/upcoming", subHandler.GetUpcomingCharges)
+	r.With(read, expensive).Get("/subscriptions/forecast", subHandler.GetSubscriptionForecast)
+	r.With(read).Get("/subscriptions/duplicates", subHandler.GetDuplicateSubscriptions)
+
+	r.Route("/orgs", func(r chi.Router) {
+		r.With(admin).Post("/", orgHandler.CreateOrganization)
+		r.With(admin).Get("/", orgHandler.ListOrganizations)
+		r.With(admin).Post("/{id}/members", orgHandler.AddOrgMember)
+		r.With(admin).Delete("/{id}/members/{user_id}", orgHandler.RemoveOrgMember)
+		r.With(read).Get("/{id}/members", orgHandler.ListOrgMembers)
+		r.With(read, expensive).Get("/{id}/total", orgHandler.GetOrgTotal)
+	})
+
+	r.Route("/services", func(r chi.Router) {
+		r.With(admin).Post("/", serviceHandler.CreateService)
+		r.With(read).Get("/", serviceHandler.ListServices)
+		r.With(read).Get("/{id}", serviceHandler.GetService)
+		r.With(admin).Put("/{id}", serviceHandler.UpdateService)
+		r.With(admin).Delete("/{id}", serviceHandler.DeleteService)
+		r.With(admin).Post("/{id}/plans", planHandler.CreatePlan)
+		r.With(read).Get("/{id}/plans", planHandler.ListPlans)
+	})
+
+	r.Route("/plans", func(r chi.Router) {
+		r.With(read).Get("/{id}", planHandler.GetPlan)
+		r.With(admin).Put("/{id}", planHandler.UpdatePlan)
+		r.With(admin).Delete("/{id}", planHandler.DeletePlan)
+		r.With(admin).Post("/{id}/reprice", planHandler.RepricePlan)
+	})
+
+	r.Route("/users", func(r chi.Router) {
+		r.With(write).Post("/", userHandler.CreateUser)
+		r.With(read).Get("/", userHandler.ListUsers)
+		r.With(read).Get("/{id}", userHandler.GetUser)
+		r.With(write).Put("/{id}", userHandler.UpdateUser)
+		r.With(write).Delete("/{id}", userHandler.DeleteUser)
+		r.With(read).Get("/{id}/subscriptions", userHandler.GetUserSubscriptions)
+		r.With(read, expensive).Get("/{id}/summary", userHandler.GetUserSummary)
+		r.With(read, expensive).Get("/{id}/balances", subHandler.GetUserBalances)
+	})
+
+	r.Route("/budgets", func(r chi.Router) {
+		r.With(write).Post("/", budgetHandler.CreateBudget)
+		r.With(read).Get("/", budgetHandler.ListBudgets)
+		r.With(read).Get("/{id}", budgetHandler.GetBudget)
+		r.With(write).Put("/{id}", budgetHandler.UpdateBudget)
+		r.With(write).Delete("/{id}", budgetHandler.DeleteBudget)
+		r.With(read, expensive).Get("/{id}/status", budgetHandler.GetBudgetStatus)
+	})
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Use(admin)
+		r.Post("/", webhookHandler.CreateWebhook)
+		r.Get("/", webhookHandler.ListWebhooks)
+		r.Get("/{id}", webhookHandler.GetWebhook)
+		r.Delete("/{id}", webhookHandler.DeleteWebhook)
+		r.Get("/{id}/deliveries", webhookHandler.ListWebhookDeliveries)
+		r.Post("/{id}/deliveries/{delivery_id}/redeliver", webhookHandler.RedeliverWebhookDelivery)
+	})
+
+	r.Route("/admin/api-keys", func(r chi.Router) {
+		r.Use(admin)
+		r.Post("/", keyHandler.IssueAPIKey)
+		r.Get("/", keyHandler.ListAPIKeys)
+		r.Delete("/{id}", keyHandler.RevokeAPIKey)
+	})
+
+	srv := &http.Server{
+		Addr:         ":" + cfg.ServerPort,
+		Handler:      r,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	go func() {
+		log.Infof("Server started on port %s", cfg.ServerPort)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
 
-	log.Infof("Server started on port %s", cfg.ServerPort)
-	if err := http.ListenAndServe(":"+cfg.ServerPort, r); err != nil {
-		log.Fatal(err)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Errorf("Server shutdown failed: %v", err)
 	}
+	stopJobs()
+	<-jobsDone
+	log.Info("Server stopped")
 }
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+
+	keyPrefix = "sk_"
+)
+
+// ValidScope reports whether s is one of the known scopes.
+func ValidScope(s string) bool {
+	return s == ScopeRead || s == ScopeWrite || s == ScopeAdmin
+}
+
+// Principal describes the authenticated caller of a request. API keys
+// identify a service and leave UserID empty; JWTs identify an end user.
+type Principal struct {
+	KeyID  string
+	Name   string
+	UserID string
+	Roles  []string
+	Scopes []string
+
+	// OrgID and OrgRole are filled in by Tenant.
+	OrgID   string
+	OrgRole string
+}
+
+// RestrictedUserID returns the user whose data the principal is limited to,
+// or "" when the principal may access every user's subscriptions. Only
+// non-admin end users are restricted.
+func (p *Principal) RestrictedUserID() string {
+	if p == nil || p.HasScope(ScopeAdmin) {
+		return ""
+	}
+	return p.UserID
+}
+
+// HasScope reports whether the principal was granted scope. Scopes are
+// hierarchical: admin includes write and write includes read.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		switch {
+		case s == scope, s == ScopeAdmin:
+			return true
+		case s == ScopeWrite && scope == ScopeRead:
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+type publicKey struct{}
+
+// FromContext returns the principal stored by Middleware, or nil for public
+// routes.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// CanViewOrg reports whether the principal may see organization-wide data
+// such as members and totals: admins and service keys for every
+// organization, end users only as the head of that organization.
+func (p *Principal) CanViewOrg(orgID string) bool {
+	if p.RestrictedUserID() == "" {
+		return true
+	}
+	return p.OrgID == orgID && p.OrgRole == model.OrgRoleHead
+}
+
+// GenerateKey returns a new random API key together with the hash and the
+// short prefix that are stored in the database. The plain key is only ever
+// shown once, to whoever issued it.
+func GenerateKey() (plain, hash, prefix string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	plain = keyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return plain, HashKey(plain), plain[:len(keyPrefix)+8], nil
+}
+
+// HashKey returns the hex encoded SHA-256 of an API key.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue generates a key, stores it and returns the plain text value.
+func Issue(ctx context.Context, repo repository.APIKeyRepository, name string, scopes []string, ttl time.Duration) (string, *model.APIKey, error) {
+	plain, hash, prefix, err := GenerateKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := &model.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expires := key.CreatedAt.Add(ttl)
+		key.ExpiresAt = &expires
+	}
+
+	if err := repo.Create(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return plain, key, nil
+}
+
+// Middleware authenticates requests with an API key passed either as
+// "Authorization: Bearer <key>" or in the X-API-Key header. When jwtVerifier
+// is not nil, bearer tokens shaped like a JWT are verified as such instead.
+// Requests whose path matches one of publicPaths are let through without a
+// key. A pattern ending in "/*" matches every path below it.
+func Middleware(repo repository.APIKeyRepository, jwtVerifier *JWTVerifier, publicPaths []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPublic(r.URL.Path, publicPaths) {
+				ctx := context.WithValue(r.Context(), publicKey{}, true)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			token := extractKey(r)
+			if token == "" {
+				unauthorized(w, "API key is required")
+				return
+			}
+
+			if jwtVerifier != nil && isJWT(token) {
+				p, err := jwtVerifier.Verify(token)
+				if err != nil {
+					logger.FromContext(r.Context()).Warnf("JWT rejected: %v", err)
+					unauthorized(w, "Invalid token")
+					return
+				}
+				ctx := NewContext(r.Context(), p)
+				ctx = logger.WithFields(ctx, log.Fields{"caller_id": p.UserID})
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			key, err := repo.GetActiveByHash(r.Context(), HashKey(token))
+			if err != nil {
+				http.Error(w, "Failed to verify API key", http.StatusInternalServerError)
+				return
+			}
+			if key == nil {
+				unauthorized(w, "Invalid API key")
+				return
+			}
+			if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+				unauthorized(w, "API key has expired")
+				return
+			}
+
+			p := &Principal{KeyID: key.ID, Name: key.Name, Scopes: key.Scopes, Roles: rolesForScopes(key.Scopes)}
+			ctx := NewContext(r.Context(), p)
+			ctx = logger.WithFields(ctx, log.Fields{"api_key_id": key.ID})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope rejects requests whose principal lacks scope. Routes that
+// were configured as public are let through unchanged.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if public, _ := r.Context().Value(publicKey{}).(bool); public {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p := FromContext(r.Context())
+			if p == nil {
+				unauthorized(w, "API key is required")
+				return
+			}
+			if !p.HasScope(scope) {
+				http.Error(w, "Insufficient scope, "+scope+" is required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rolesForScopes maps API key scopes onto the policy roles of the same
+// strength, so keys and user tokens go through the same policy checks.
+func rolesForScopes(scopes []string) []string {
+	var roles []string
+	for _, s := range scopes {
+		switch s {
+		case ScopeAdmin:
+			roles = append(roles, "admin")
+		case ScopeWrite:
+			roles = append(roles, "editor")
+		case ScopeRead:
+			roles = append(roles, "viewer")
+		}
+	}
+	return roles
+}
+
+func extractKey(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func isPublic(path string, publicPaths []string) bool {
+	for _, p := range publicPaths {
+		if prefix, ok := strings.CutSuffix(p, "/*"); ok {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="subscription_service"`)
+	http.Error(w, msg, http.StatusUnauthorized)
+}
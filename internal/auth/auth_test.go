@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+type fakeKeyRepo struct {
+	keys map[string]*model.APIKey
+}
+
+func (f *fakeKeyRepo) Create(ctx context.Context, key *model.APIKey) error {
+	f.keys[key.KeyHash] = key
+	return nil
+}
+
+func (f *fakeKeyRepo) GetActiveByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	return f.keys[hash], nil
+}
+
+func (f *fakeKeyRepo) List(ctx context.Context) ([]*model.APIKey, error) { return nil, nil }
+
+func (f *fakeKeyRepo) Revoke(ctx context.Context, id string) (bool, error) { return false, nil }
+
+func newTestRouter(repo *fakeKeyRepo, scope string) http.Handler {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return Middleware(repo, nil, []string{"/health", "/swagger/*"})(RequireScope(scope)(ok))
+}
+
+func TestMiddleware(t *testing.T) {
+	repo := &fakeKeyRepo{keys: map[string]*model.APIKey{}}
+	readKey, _, _ := Issue(context.Background(), repo, "reader", []string{ScopeRead}, 0)
+	writeKey, _, _ := Issue(context.Background(), repo, "writer", []string{ScopeWrite}, 0)
+	expiredKey, _, _ := Issue(context.Background(), repo, "old", []string{ScopeAdmin}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		name   string
+		path   string
+		scope  string
+		header string
+		value  string
+		want   int
+	}{
+		{"public path", "/swagger/index.html", ScopeAdmin, "", "", http.StatusOK},
+		{"missing key", "/subscriptions", ScopeRead, "", "", http.StatusUnauthorized},
+		{"unknown key", "/subscriptions", ScopeRead, "X-API-Key", "sk_nope", http.StatusUnauthorized},
+		{"bearer key", "/subscriptions", ScopeRead, "Authorization", "Bearer " + readKey, http.StatusOK},
+		{"write implies read", "/subscriptions", ScopeRead, "X-API-Key", writeKey, http.StatusOK},
+		{"insufficient scope", "/subscriptions", ScopeWrite, "X-API-Key", readKey, http.StatusForbidden},
+		{"expired key", "/subscriptions", ScopeRead, "X-API-Key", expiredKey, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+
+			newTestRouter(repo, tt.scope).ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
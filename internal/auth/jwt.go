@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Elmar006/subscription_service/internal/config"
+)
+
+// jwksRefreshInterval limits how often an unknown key ID triggers a new
+// JWKS download.
+const jwksRefreshInterval = time.Minute
+
+// JWTVerifier validates bearer JWTs and turns their claims into a Principal.
+type JWTVerifier struct {
+	cfg         config.JWTConfig
+	defaultRole string
+	client      *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWTVerifier returns a verifier for cfg, or nil when JWT authentication
+// is not configured. Tokens without roles get defaultRole. RSA keys are
+// loaded eagerly so that a broken JWKS source is reported at startup.
+func NewJWTVerifier(cfg config.JWTConfig, defaultRole string) (*JWTVerifier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	v := &JWTVerifier{
+		cfg:         cfg,
+		defaultRole: defaultRole,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		keys:        map[string]*rsa.PublicKey{},
+	}
+	if cfg.JWKSFile != "" || cfg.JWKSURL != "" {
+		if err := v.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Verify checks the signature and standard claims of token and returns the
+// caller it identifies.
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.validMethods()),
+		jwt.WithExpirationRequired(),
+	}
+	if v.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.cfg.Issuer))
+	}
+	if v.cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.cfg.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, v.keyFunc, opts...); err != nil {
+		return nil, err
+	}
+
+	userID, _ := claims[v.cfg.UserClaim].(string)
+	if userID == "" {
+		return nil, fmt.Errorf("claim %q is missing", v.cfg.UserClaim)
+	}
+
+	p := &Principal{
+		UserID: userID,
+		Roles:  stringsClaim(claims[v.cfg.RolesClaim]),
+		Scopes: []string{ScopeWrite},
+	}
+	if len(p.Roles) == 0 {
+		p.Roles = []string{v.defaultRole}
+	}
+	for _, role := range p.Roles {
+		if role == v.cfg.AdminRole {
+			p.Scopes = []string{ScopeAdmin}
+		}
+	}
+	return p, nil
+}
+
+func (v *JWTVerifier) validMethods() []string {
+	var methods []string
+	if v.cfg.Secret != "" {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if v.cfg.JWKSFile != "" || v.cfg.JWKSURL != "" {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	return methods
+}
+
+func (v *JWTVerifier) keyFunc(t *jwt.Token) (any, error) {
+	switch t.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return []byte(v.cfg.Secret), nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := t.Header["kid"].(string)
+		if key := v.key(kid); key != nil {
+			return key, nil
+		}
+		if v.cfg.JWKSURL != "" && v.canRefresh() {
+			if err := v.loadKeys(); err != nil {
+				return nil, err
+			}
+			if key := v.key(kid); key != nil {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+}
+
+// key returns the RSA key with the given ID. Tokens without a kid are
+// accepted when the key set holds exactly one key.
+func (v *JWTVerifier) key(kid string) *rsa.PublicKey {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k
+		}
+	}
+	return v.keys[kid]
+}
+
+func (v *JWTVerifier) canRefresh() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return time.Since(v.fetchedAt) > jwksRefreshInterval
+}
+
+func (v *JWTVerifier) loadKeys() error {
+	var data []byte
+	var err error
+	if v.cfg.JWKSFile != "" {
+		data, err = os.ReadFile(v.cfg.JWKSFile)
+	} else {
+		data, err = v.fetchJWKS()
+	}
+	if err != nil {
+		return fmt.Errorf("load JWKS: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *JWTVerifier) fetchJWKS() ([]byte, error) {
+	resp, err := v.client.Get(v.cfg.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// parseJWKS extracts the RSA public keys from a JWK set, skipping keys of
+// other types.
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid modulus", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid exponent", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA keys found")
+	}
+	return keys, nil
+}
+
+// stringsClaim accepts a claim holding either a single string or a list of
+// strings.
+func stringsClaim(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		var out []string
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
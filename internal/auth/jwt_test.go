@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Elmar006/subscription_service/internal/config"
+)
+
+func testJWTConfig() config.JWTConfig {
+	return config.JWTConfig{UserClaim: "sub", RolesClaim: "roles", AdminRole: "admin"}
+}
+
+func TestVerifyHS256(t *testing.T) {
+	cfg := testJWTConfig()
+	cfg.Secret = "test-secret"
+	v, err := NewJWTVerifier(cfg, "editor")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier failed: %v", err)
+	}
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test-secret"))
+
+	p, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if p.UserID != "user-1" || p.RestrictedUserID() != "user-1" {
+		t.Errorf("Expected restricted principal for user-1, got %+v", p)
+	}
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("other-secret"))
+	if _, err := v.Verify(forged); err == nil {
+		t.Error("Expected token signed with another secret to be rejected")
+	}
+}
+
+func TestVerifyRS256WithJWKSFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testJWTConfig()
+	cfg.JWKSFile = path
+	v, err := NewJWTVerifier(cfg, "editor")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier failed: %v", err)
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub":   "admin-1",
+		"roles": []string{"admin"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	tok.Header["kid"] = "k1"
+	token, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !p.HasScope(ScopeAdmin) || p.RestrictedUserID() != "" {
+		t.Errorf("Expected unrestricted admin principal, got %+v", p)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+const OrgHeader = "X-Org-ID"
+
+// Tenant scopes authenticated requests to the organization chosen with the
+// X-Org-ID header, which for end users must be one of theirs. Without the
+// header no request is scoped, however many organizations the user belongs
+// to, so joining one does not hide the user's personal subscriptions.
+func Tenant(orgs repository.OrganizationRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := FromContext(r.Context())
+			if p == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requested := r.Header.Get(OrgHeader)
+			if requested != "" {
+				if _, err := uuid.Parse(requested); err != nil {
+					http.Error(w, "Invalid "+OrgHeader+" header", http.StatusBadRequest)
+					return
+				}
+			}
+			if p.RestrictedUserID() == "" {
+				if requested != "" {
+					org, err := orgs.GetByID(r.Context(), requested)
+					if err != nil {
+						http.Error(w, "Failed to resolve organization", http.StatusInternalServerError)
+						return
+					}
+					if org == nil {
+						http.Error(w, "Organization "+requested+" not found", http.StatusNotFound)
+						return
+					}
+					p.OrgID = requested
+				}
+			} else if requested != "" {
+				memberships, err := orgs.MembershipsOf(r.Context(), p.UserID)
+				if err != nil {
+					http.Error(w, "Failed to resolve organization", http.StatusInternalServerError)
+					return
+				}
+
+				m := selectMembership(memberships, requested)
+				if m == nil {
+					http.Error(w, "Not a member of organization "+requested, http.StatusForbidden)
+					return
+				}
+				p.OrgID = m.OrgID
+				p.OrgRole = m.Role
+			}
+
+			ctx := r.Context()
+			if p.OrgID != "" {
+				ctx = tenant.WithOrg(ctx, p.OrgID)
+				ctx = logger.WithFields(ctx, log.Fields{"org_id": p.OrgID})
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func selectMembership(memberships []*model.OrgMember, requested string) *model.OrgMember {
+	for _, m := range memberships {
+		if m.OrgID == requested {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+)
+
+const (
+	orgA = "0b6f8a52-1c2d-4e3f-8a9b-0c1d2e3f4a5b"
+	orgB = "1c7a9b63-2d3e-4f5a-9b0c-1d2e3f4a5b6c"
+	orgC = "2d8b0c74-3e4f-4a6b-8c1d-2e3f4a5b6c7d"
+)
+
+type fakeOrgRepo struct {
+	repository.OrganizationRepository
+	memberships []*model.OrgMember
+}
+
+func (f *fakeOrgRepo) GetByID(ctx context.Context, id string) (*model.Organization, error) {
+	if id == orgC {
+		return &model.Organization{ID: id}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeOrgRepo) MembershipsOf(ctx context.Context, userID string) ([]*model.OrgMember, error) {
+	return f.memberships, nil
+}
+
+func TestTenant(t *testing.T) {
+	orgs := &fakeOrgRepo{memberships: []*model.OrgMember{
+		{OrgID: orgA, UserID: "user-1", Role: model.OrgRoleHead, CreatedAt: time.Now()},
+		{OrgID: orgB, UserID: "user-1", Role: model.OrgRoleMember, CreatedAt: time.Now()},
+	}}
+
+	single := &fakeOrgRepo{memberships: orgs.memberships[:1]}
+
+	tests := []struct {
+		orgs    repository.OrganizationRepository
+		name    string
+		scopes  []string
+		header  string
+		wantOrg string
+		want    int
+	}{
+		{orgs, "user picks own org", []string{ScopeWrite}, orgB, orgB, http.StatusOK},
+		{orgs, "user with several orgs and no header", []string{ScopeWrite}, "", "", http.StatusOK},
+		{single, "user with one org and no header", []string{ScopeWrite}, "", "", http.StatusOK},
+		{single, "user with one org picks it", []string{ScopeWrite}, orgA, orgA, http.StatusOK},
+		{orgs, "user picks foreign org", []string{ScopeWrite}, orgC, "", http.StatusForbidden},
+		{orgs, "admin picks any org", []string{ScopeAdmin}, orgC, orgC, http.StatusOK},
+		{orgs, "admin picks missing org", []string{ScopeAdmin}, orgA, "", http.StatusNotFound},
+		{orgs, "admin sends malformed org", []string{ScopeAdmin}, "org-c", "", http.StatusBadRequest},
+		{orgs, "user sends malformed org", []string{ScopeWrite}, "org-c", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOrg string
+			h := Tenant(tt.orgs)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotOrg = tenant.OrgID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/subscriptions", nil)
+			if tt.header != "" {
+				req.Header.Set(OrgHeader, tt.header)
+			}
+			req = req.WithContext(NewContext(req.Context(), &Principal{UserID: "user-1", Scopes: tt.scopes}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.want || gotOrg != tt.wantOrg {
+				t.Errorf("Expected %d with org %q, got %d with org %q", tt.want, tt.wantOrg, w.Code, gotOrg)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Package billing computes when subscriptions charge and how much.
+//
+// A subscription charges on its anchor date and then every billing period
+// after it until its end date. The anchor is the trial end date for
+// subscriptions with a trial and the start date otherwise, so nothing is
+// charged during a trial. Charges within IntroMonths of the anchor cost
+// IntroPrice instead of Price, and charges falling into a pause are
+// skipped.
+package billing
+
+import (
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+const dateLayout = "2006-01-02"
+
+// Charge is a single payment of a subscription.
+type Charge struct {
+	Date   time.Time
+	Amount model.Money
+}
+
+// Currency returns the currency all of subs are priced in, "" when subs is
+// empty, or model.ErrMixedCurrencies. Amounts are only ever added up within
+// one currency.
+func Currency(subs []*model.Subscription) (string, error) {
+	currency := ""
+	for _, sub := range subs {
+		switch {
+		case currency == "":
+			currency = sub.Price.Currency
+		case sub.Price.Currency != currency:
+			return "", model.ErrMixedCurrencies
+		}
+	}
+	return currency, nil
+}
+
+// AddMonths adds n months to t, clamping the day to the end of the target
+// month so that Jan 31 plus one month is Feb 28 rather than Mar 3.
+func AddMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, t.Location())
+}
+
+// Anchor returns the date of the first paid charge of sub.
+func Anchor(sub *model.Subscription) (time.Time, bool) {
+	if sub.TrialEndDate != "" {
+		if t, err := sub.TrialEndDate.Last(); err == nil {
+			return t, true
+		}
+	}
+	t, err := sub.StartDate.First()
+	return t, err == nil
+}
+
+// InTrial reports whether day falls into the free trial of sub.
+func InTrial(sub *model.Subscription, day time.Time) bool {
+	anchor, ok := Anchor(sub)
+	return ok && sub.TrialEndDate != "" && day.Before(anchor)
+}
+
+// Paused reports whether sub is paused on day according to its
+// transitions, which must be in chronological order.
+func Paused(sub *model.Subscription, day time.Time) bool {
+	paused := false
+	for _, t := range sub.Transitions {
+		eff, err := t.EffectiveDate.First()
+		if err != nil || eff.After(day) {
+			break
+		}
+		paused = t.To == model.StatusPaused
+	}
+	return paused
+}
+
+// AmountAt returns what a charge of sub on day costs: nothing during the
+// trial, the intro price during the intro period and otherwise the price
+// in effect on day, see PriceAt.
+func AmountAt(sub *model.Subscription, day time.Time) model.Money {
+	anchor, ok := Anchor(sub)
+	if !ok || day.Before(anchor) {
+		return model.Money{Currency: sub.Price.Currency}
+	}
+	if sub.IntroPrice != nil && day.Before(AddMonths(anchor, sub.IntroMonths)) {
+		return *sub.IntroPrice
+	}
+	return PriceAt(sub, day)
+}
+
+// PriceAt returns the regular price of sub on day, taking its price changes
+// into account. They must be ordered by effective date.
+//
+// Applied changes are already copied into sub.Price, which therefore holds
+// from the last of them on; before the first one the subscription had the
+// price that change replaced.
+func PriceAt(sub *model.Subscription, day time.Time) model.Money {
+	price, last := sub.Price, -1
+	for i, pc := range sub.PriceChanges {
+		if pc.AppliedAt == nil {
+			continue
+		}
+		if last == -1 && pc.PreviousPrice != nil {
+			price = *pc.PreviousPrice
+		}
+		last = i
+	}
+	for i, pc := range sub.PriceChanges {
+		if eff, err := pc.EffectiveDate.First(); err != nil || eff.After(day) {
+			break
+		}
+		price = pc.Price
+		if i == last {
+			price = sub.Price
+		}
+	}
+	return price
+}
+
+// MonthlyAmount returns the cost of sub on day spread over one month of its
+// billing period, rounded to the nearest minor unit.
+func MonthlyAmount(sub *model.Subscription, day time.Time) model.Money {
+	months := model.BillingMonths(sub.BillingPeriod)
+	if months == 0 {
+		months = 1
+	}
+	return AmountAt(sub, day).Prorate(1, int64(months))
+}
+
+// Charges returns the charges of sub due between from and to, both
+// inclusive. Subscriptions with malformed dates have no charges.
+func Charges(sub *model.Subscription, from, to time.Time) []Charge {
+	anchor, ok := Anchor(sub)
+	if !ok {
+		return nil
+	}
+	var end time.Time
+	if sub.EndDate != "" {
+		t, err := sub.EndDate.Last()
+		if err != nil {
+			return nil
+		}
+		end = t
+	}
+	months := model.BillingMonths(sub.BillingPeriod)
+	if months == 0 {
+		months = 1
+	}
+
+	// Start at the first charge on or after from rather than stepping
+	// through every period since the anchor.
+	k := 0
+	if from.After(anchor) {
+		elapsed := (from.Year()-anchor.Year())*12 + int(from.Month()-anchor.Month())
+		k = max(0, elapsed/months-1)
+	}
+
+	var charges []Charge
+	for ; ; k++ {
+		date := AddMonths(anchor, k*months)
+		if date.After(to) || (!end.IsZero() && date.After(end)) {
+			break
+		}
+		if date.Before(from) || Paused(sub, date) {
+			continue
+		}
+		charges = append(charges, Charge{Date: date, Amount: AmountAt(sub, date)})
+	}
+	return charges
+}
+
+// NextCharge returns the first charge of sub due on or after day within
+// the next twelve billing periods.
+func NextCharge(sub *model.Subscription, day time.Time) (Charge, bool) {
+	months := model.BillingMonths(sub.BillingPeriod)
+	if months == 0 {
+		months = 1
+	}
+	charges := Charges(sub, day, AddMonths(day, 12*months))
+	if len(charges) == 0 {
+		return Charge{}, false
+	}
+	return charges[0], true
+}
+
+// Total sums the charges of subs due between from and to.
+func Total(subs []*model.Subscription, from, to time.Time) (model.Money, error) {
+	currency, err := Currency(subs)
+	if err != nil {
+		return model.Money{}, err
+	}
+	total := model.Money{Currency: currency}
+	for _, sub := range subs {
+		for _, c := range Charges(sub, from, to) {
+			total = total.Add(c.Amount)
+		}
+	}
+	return total, nil
+}
+
+// Forecast returns the charges of subs per calendar month for the given
+// number of months starting with the month containing from, and their sum.
+func Forecast(subs []*model.Subscription, from time.Time, months int) ([]model.MonthAmount, model.Money, error) {
+	return forecast(from, months, func(first, last time.Time) (model.Money, error) {
+		return Total(subs, first, last)
+	})
+}
+
+// forecast calls sum for each calendar month of the forecast.
+func forecast(from time.Time, months int, sum func(first, last time.Time) (model.Money, error)) ([]model.MonthAmount, model.Money, error) {
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	out := make([]model.MonthAmount, months)
+	var total model.Money
+	for i := range out {
+		first := start.AddDate(0, i, 0)
+		amount, err := sum(first, first.AddDate(0, 1, -1))
+		if err != nil {
+			return nil, model.Money{}, err
+		}
+		out[i] = model.MonthAmount{Month: first.Format("2006-01"), Amount: amount}
+		total = total.Add(amount)
+	}
+	return out, total, nil
+}
@@ -0,0 +1,244 @@
+package billing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse(dateLayout, s)
+	return t
+}
+
+func rub(amount int64) model.Money {
+	return model.Money{Amount: amount, Currency: "RUB"}
+}
+
+func TestAddMonthsClampsToMonthEnd(t *testing.T) {
+	cases := []struct {
+		from string
+		n    int
+		want string
+	}{
+		{"2026-01-31", 1, "2026-02-28"},
+		{"2026-01-31", 2, "2026-03-31"},
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2026-11-15", 3, "2027-02-15"},
+	}
+	for _, c := range cases {
+		if got := AddMonths(date(c.from), c.n).Format(dateLayout); got != c.want {
+			t.Errorf("AddMonths(%s, %d) = %s, want %s", c.from, c.n, got, c.want)
+		}
+	}
+}
+
+func TestChargesMonthly(t *testing.T) {
+	sub := &model.Subscription{Price: rub(100), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-31", EndDate: "2026-04-30"}
+
+	charges := Charges(sub, date("2026-02-01"), date("2026-12-31"))
+	want := []string{"2026-02-28", "2026-03-31", "2026-04-30"}
+	if len(charges) != len(want) {
+		t.Fatalf("Expected %d charges, got %v", len(want), charges)
+	}
+	for i, c := range charges {
+		if c.Date.Format(dateLayout) != want[i] || c.Amount != rub(100) {
+			t.Errorf("Charge %d = %v, want %s for 100", i, c, want[i])
+		}
+	}
+}
+
+func TestChargesLongBefore(t *testing.T) {
+	sub := &model.Subscription{Price: rub(100), BillingPeriod: model.BillingQuarterly, StartDate: "1000-01-31"}
+
+	charges := Charges(sub, date("9000-05-01"), date("9000-12-31"))
+	want := []string{"9000-07-31", "9000-10-31"}
+	if len(charges) != len(want) {
+		t.Fatalf("Expected %d charges, got %v", len(want), charges)
+	}
+	for i, c := range charges {
+		if c.Date.Format(dateLayout) != want[i] {
+			t.Errorf("Charge %d = %v, want %s", i, c, want[i])
+		}
+	}
+}
+
+func TestChargesMonthDates(t *testing.T) {
+	sub := &model.Subscription{Price: rub(100), BillingPeriod: model.BillingMonthly, StartDate: "07-2025", EndDate: "2025-09"}
+
+	charges := Charges(sub, date("2025-01-01"), date("2025-12-31"))
+	want := []string{"2025-07-01", "2025-08-01", "2025-09-01"}
+	if len(charges) != len(want) {
+		t.Fatalf("Expected %d charges, got %v", len(want), charges)
+	}
+	for i, c := range charges {
+		if c.Date.Format(dateLayout) != want[i] {
+			t.Errorf("Charge %d = %v, want %s", i, c, want[i])
+		}
+	}
+}
+
+func TestChargesYearly(t *testing.T) {
+	sub := &model.Subscription{Price: rub(1200), BillingPeriod: model.BillingYearly, StartDate: "2025-06-01"}
+
+	if total, err := Total([]*model.Subscription{sub}, date("2026-01-01"), date("2027-12-31")); err != nil || total != rub(2400) {
+		t.Errorf("Expected 24.00, got %s, %v", total, err)
+	}
+	if got := MonthlyAmount(sub, date("2026-01-01")); got != rub(100) {
+		t.Errorf("Expected monthly amount 1.00, got %s", got)
+	}
+
+	// 9.99 a quarter is 3.33 a month, 10.00 a year 0.83 rounded to nearest.
+	quarterly := &model.Subscription{Price: rub(999), BillingPeriod: model.BillingQuarterly, StartDate: "2025-06-01"}
+	yearly := &model.Subscription{Price: rub(1000), BillingPeriod: model.BillingYearly, StartDate: "2025-06-01"}
+	if got := MonthlyAmount(quarterly, date("2026-01-01")); got != rub(333) {
+		t.Errorf("Expected monthly amount 3.33, got %s", got)
+	}
+	if got := MonthlyAmount(yearly, date("2026-01-01")); got != rub(83) {
+		t.Errorf("Expected monthly amount 0.83, got %s", got)
+	}
+}
+
+func TestTrialAndIntroPrice(t *testing.T) {
+	intro := rub(10)
+	sub := &model.Subscription{
+		Price: rub(100), BillingPeriod: model.BillingMonthly,
+		StartDate: "2026-01-01", TrialEndDate: "2026-01-15",
+		IntroPrice: &intro, IntroMonths: 2,
+	}
+
+	if !InTrial(sub, date("2026-01-10")) || InTrial(sub, date("2026-01-15")) {
+		t.Errorf("Trial should cover days before 2026-01-15 only")
+	}
+
+	charges := Charges(sub, date("2026-01-01"), date("2026-04-30"))
+	want := []Charge{
+		{date("2026-01-15"), rub(10)},
+		{date("2026-02-15"), rub(10)},
+		{date("2026-03-15"), rub(100)},
+		{date("2026-04-15"), rub(100)},
+	}
+	if len(charges) != len(want) {
+		t.Fatalf("Expected %d charges, got %v", len(want), charges)
+	}
+	for i := range want {
+		if !charges[i].Date.Equal(want[i].Date) || charges[i].Amount != want[i].Amount {
+			t.Errorf("Charge %d = %v, want %v", i, charges[i], want[i])
+		}
+	}
+}
+
+func TestChargesSkipPause(t *testing.T) {
+	sub := &model.Subscription{
+		Price: rub(100), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01",
+		Transitions: []model.Transition{
+			{From: model.StatusActive, To: model.StatusPaused, EffectiveDate: "2026-02-10"},
+			{From: model.StatusPaused, To: model.StatusActive, EffectiveDate: "2026-04-20"},
+		},
+	}
+
+	// January and February 1st are charged, March and April 1st fall into
+	// the pause, May and June are charged again.
+	if total, _ := Total([]*model.Subscription{sub}, date("2026-01-01"), date("2026-06-30")); total != rub(400) {
+		t.Errorf("Expected 4.00, got %s", total)
+	}
+	if !Paused(sub, date("2026-03-01")) || Paused(sub, date("2026-04-20")) {
+		t.Errorf("Pause should cover 2026-02-10 to 2026-04-19")
+	}
+}
+
+func TestNextCharge(t *testing.T) {
+	sub := &model.Subscription{Price: rub(300), BillingPeriod: model.BillingQuarterly, StartDate: "2026-01-15", EndDate: "2026-12-31"}
+
+	cases := []struct {
+		day  string
+		want string
+		ok   bool
+	}{
+		{"2025-12-01", "2026-01-15", true},
+		{"2026-01-15", "2026-01-15", true},
+		{"2026-01-16", "2026-04-15", true},
+		{"2026-10-16", "", false},
+	}
+	for _, c := range cases {
+		got, ok := NextCharge(sub, date(c.day))
+		if ok != c.ok || (ok && got.Date.Format(dateLayout) != c.want) {
+			t.Errorf("NextCharge(%s) = %v, %v, want %s, %v", c.day, got.Date.Format(dateLayout), ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestMixedCurrencies(t *testing.T) {
+	subs := []*model.Subscription{
+		{Price: rub(100), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01"},
+		{Price: model.Money{Amount: 100, Currency: "USD"}, BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01"},
+	}
+	if _, err := Total(subs, date("2026-01-01"), date("2026-01-31")); err != model.ErrMixedCurrencies {
+		t.Errorf("Expected ErrMixedCurrencies, got %v", err)
+	}
+}
+
+func TestPriceAtAppliedChanges(t *testing.T) {
+	applied := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	sub := &model.Subscription{
+		Price:         rub(350),
+		BillingPeriod: model.BillingMonthly,
+		StartDate:     "2026-01-10",
+		PriceChanges: []model.PriceChange{
+			{Price: rub(320), PreviousPrice: &model.Money{Amount: 300, Currency: "RUB"}, EffectiveDate: "2026-02-01", AppliedAt: &applied},
+			{Price: rub(350), PreviousPrice: &model.Money{Amount: 320, Currency: "RUB"}, EffectiveDate: "2026-03-01", AppliedAt: &applied},
+			{Price: rub(400), EffectiveDate: "2026-05-01"},
+		},
+	}
+
+	for day, want := range map[string]int64{"2026-01-10": 300, "2026-02-10": 320, "2026-03-10": 350, "2026-04-10": 350, "2026-05-10": 400} {
+		if got := PriceAt(sub, date(day)); got != rub(want) {
+			t.Errorf("PriceAt(%s) = %s, want %s", day, got, rub(want))
+		}
+	}
+
+	// A price edited after the last applied change holds from that change
+	// until the next pending one.
+	sub.Price = rub(360)
+	if got := PriceAt(sub, date("2026-04-10")); got != rub(360) {
+		t.Errorf("Expected the edited price after the last applied change, got %s", got)
+	}
+	if got := PriceAt(sub, date("2026-02-10")); got != rub(320) {
+		t.Errorf("Expected the applied price before the edit, got %s", got)
+	}
+}
+
+func TestForecast(t *testing.T) {
+	sub := &model.Subscription{
+		Price:         rub(300),
+		BillingPeriod: model.BillingMonthly,
+		StartDate:     "2026-01-10",
+		EndDate:       "2026-05-31",
+		PriceChanges:  []model.PriceChange{{Price: rub(350), EffectiveDate: "2026-03-01"}, {Price: rub(400), EffectiveDate: "2026-05-01"}},
+	}
+	yearly := &model.Subscription{Price: rub(1200), BillingPeriod: model.BillingYearly, StartDate: "2025-04-20"}
+
+	months, total, err := Forecast([]*model.Subscription{sub, yearly}, date("2026-02-14"), 5)
+	if err != nil {
+		t.Fatalf("Forecast failed: %v", err)
+	}
+	want := []model.MonthAmount{
+		{Month: "2026-02", Amount: rub(300)},
+		{Month: "2026-03", Amount: rub(350)},
+		{Month: "2026-04", Amount: rub(350 + 1200)},
+		{Month: "2026-05", Amount: rub(400)},
+		{Month: "2026-06", Amount: rub(0)},
+	}
+	if len(months) != len(want) {
+		t.Fatalf("Expected %d months, got %+v", len(want), months)
+	}
+	for i := range want {
+		if months[i] != want[i] {
+			t.Errorf("Month %d = %+v, want %+v", i, months[i], want[i])
+		}
+	}
+	if total != rub(2600) {
+		t.Errorf("Expected total 26.00, got %s", total)
+	}
+}
@@ -0,0 +1,119 @@
+package billing
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+// Shares splits a charge of amount between the payer of sub, its user, and
+// its members. Fixed amounts are taken first in the order of the members,
+// as far as the charge covers them. The rest is split by weight between the
+// other members and the payer, who has weight 1 unless listed. Weighted
+// parts are rounded down to the minor unit and whatever is left goes to the
+// payer, so the shares always add up to the charge and none is negative.
+// Unshared subscriptions are paid by their payer alone.
+func Shares(sub *model.Subscription, amount model.Money) map[string]model.Money {
+	shares := map[string]model.Money{}
+	rest := amount
+
+	payerWeight := int64(1)
+	weights := int64(0)
+	for _, m := range sub.Members {
+		if m.UserID == sub.UserID {
+			payerWeight = 0
+		}
+		if m.Amount != nil {
+			fixed := m.Amount.Min(rest)
+			shares[m.UserID] = shares[m.UserID].Add(fixed)
+			rest = rest.Sub(fixed)
+			continue
+		}
+		weights += int64(m.Weight)
+	}
+	weights += payerWeight
+
+	split := rest
+	for _, m := range sub.Members {
+		if m.Amount == nil && weights > 0 {
+			part := model.Money{Amount: split.Amount * int64(m.Weight) / weights, Currency: split.Currency}
+			shares[m.UserID] = shares[m.UserID].Add(part)
+			rest = rest.Sub(part)
+		}
+	}
+	shares[sub.UserID] = shares[sub.UserID].Add(rest)
+	return shares
+}
+
+// ShareTotal sums the shares of userID in the charges of subs due between
+// from and to.
+func ShareTotal(subs []*model.Subscription, userID string, from, to time.Time) (model.Money, error) {
+	currency, err := Currency(subs)
+	if err != nil {
+		return model.Money{}, err
+	}
+	total := model.Money{Currency: currency}
+	for _, sub := range subs {
+		for _, c := range Charges(sub, from, to) {
+			total = total.Add(Shares(sub, c.Amount)[userID])
+		}
+	}
+	return total, nil
+}
+
+// ShareForecast is Forecast of the shares of userID, see ShareTotal.
+func ShareForecast(subs []*model.Subscription, userID string, from time.Time, months int) ([]model.MonthAmount, model.Money, error) {
+	return forecast(from, months, func(first, last time.Time) (model.Money, error) {
+		return ShareTotal(subs, userID, first, last)
+	})
+}
+
+// Balances nets what userID and the other users of the subscriptions in subs
+// owe each other for the charges due between from and to. The payer of a
+// subscription pays every charge and its members owe the payer their share.
+func Balances(subs []*model.Subscription, userID string, from, to time.Time) (model.Balances, error) {
+	currency, err := Currency(subs)
+	if err != nil {
+		return model.Balances{}, err
+	}
+	net := map[string]int64{}
+	for _, sub := range subs {
+		if len(sub.Members) == 0 {
+			continue
+		}
+		for _, c := range Charges(sub, from, to) {
+			for member, share := range Shares(sub, c.Amount) {
+				switch {
+				case member == sub.UserID || share.Amount == 0:
+				case sub.UserID == userID:
+					net[member] += share.Amount
+				case member == userID:
+					net[sub.UserID] -= share.Amount
+				}
+			}
+		}
+	}
+
+	b := model.Balances{
+		UserID: userID, From: model.DateOf(from), To: model.DateOf(to),
+		Owed: model.Money{Currency: currency}, Owes: model.Money{Currency: currency}, Debts: []model.Debt{},
+	}
+	for other, amount := range net {
+		switch {
+		case amount > 0:
+			b.Owed.Amount += amount
+			b.Debts = append(b.Debts, model.Debt{From: other, To: userID, Amount: model.Money{Amount: amount, Currency: currency}})
+		case amount < 0:
+			b.Owes.Amount -= amount
+			b.Debts = append(b.Debts, model.Debt{From: userID, To: other, Amount: model.Money{Amount: -amount, Currency: currency}})
+		}
+	}
+	sort.Slice(b.Debts, func(i, j int) bool {
+		if b.Debts[i].Amount.Amount != b.Debts[j].Amount.Amount {
+			return b.Debts[i].Amount.Amount > b.Debts[j].Amount.Amount
+		}
+		return b.Debts[i].From+b.Debts[i].To < b.Debts[j].From+b.Debts[j].To
+	})
+	return b, nil
+}
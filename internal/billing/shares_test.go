@@ -0,0 +1,75 @@
+package billing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+func TestShares(t *testing.T) {
+	fixed := rub(300)
+	cases := []struct {
+		name    string
+		members []model.Member
+		amount  int64
+		want    map[string]int64
+	}{
+		{"unshared", nil, 1000, map[string]int64{"payer": 1000}},
+		{"equal weights", []model.Member{{UserID: "a", Weight: 1}, {UserID: "b", Weight: 1}}, 1000,
+			map[string]int64{"payer": 334, "a": 333, "b": 333}},
+		{"payer listed", []model.Member{{UserID: "payer", Weight: 1}, {UserID: "a", Weight: 3}}, 1000,
+			map[string]int64{"payer": 250, "a": 750}},
+		{"fixed amount first", []model.Member{{UserID: "a", Amount: &fixed}, {UserID: "b", Weight: 1}}, 1000,
+			map[string]int64{"payer": 350, "a": 300, "b": 350}},
+		{"fixed amount capped", []model.Member{{UserID: "a", Amount: &fixed}}, 200,
+			map[string]int64{"payer": 0, "a": 200}},
+	}
+	for _, c := range cases {
+		sub := &model.Subscription{UserID: "payer", Members: c.members}
+		want := map[string]model.Money{}
+		for user, amount := range c.want {
+			want[user] = rub(amount)
+		}
+		if got := Shares(sub, rub(c.amount)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Shares = %v, want %v", c.name, got, want)
+		}
+	}
+}
+
+func TestBalances(t *testing.T) {
+	family := &model.Subscription{UserID: "payer", Price: rub(900), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01",
+		Members: []model.Member{{UserID: "a", Weight: 1}, {UserID: "b", Weight: 1}}}
+	music := &model.Subscription{UserID: "a", Price: rub(200), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-15",
+		Members: []model.Member{{UserID: "payer", Weight: 1}}}
+	own := &model.Subscription{UserID: "payer", Price: rub(500), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01"}
+	subs := []*model.Subscription{family, music, own}
+
+	got, err := Balances(subs, "payer", date("2026-01-01"), date("2026-02-28"))
+	if err != nil {
+		t.Fatalf("Balances failed: %v", err)
+	}
+	want := []model.Debt{{From: "b", To: "payer", Amount: rub(600)}, {From: "a", To: "payer", Amount: rub(400)}}
+	if !reflect.DeepEqual(got.Debts, want) || got.Owed != rub(1000) || got.Owes != rub(0) {
+		t.Errorf("Unexpected balances %+v", got)
+	}
+
+	if total, _ := ShareTotal(subs, "payer", date("2026-01-01"), date("2026-01-31")); total != rub(300+100+500) {
+		t.Errorf("Expected the payer's share to be 9.00, got %s", total)
+	}
+}
+
+func TestShareForecast(t *testing.T) {
+	family := &model.Subscription{UserID: "payer", Price: rub(900), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01",
+		EndDate: "2026-02-28", Members: []model.Member{{UserID: "a", Weight: 2}}}
+	own := &model.Subscription{UserID: "a", Price: rub(100), BillingPeriod: model.BillingMonthly, StartDate: "2026-02-01"}
+
+	months, total, err := ShareForecast([]*model.Subscription{family, own}, "a", date("2026-01-15"), 3)
+	if err != nil {
+		t.Fatalf("ShareForecast failed: %v", err)
+	}
+	want := []model.MonthAmount{{Month: "2026-01", Amount: rub(600)}, {Month: "2026-02", Amount: rub(700)}, {Month: "2026-03", Amount: rub(100)}}
+	if !reflect.DeepEqual(months, want) || total != rub(1400) {
+		t.Errorf("Unexpected forecast %v, total %s", months, total)
+	}
+}
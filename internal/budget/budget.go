@@ -0,0 +1,128 @@
+// Package budget computes the monthly spend against budgets, with the same
+// charge logic as the subscription totals, and raises an alert when a
+// subscription change pushes a budget past one of the thresholds.
+package budget
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/zone"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// Thresholds are the utilisation percentages that raise an alert.
+var Thresholds = []int{80, 100}
+
+const monthLayout = "2006-01"
+
+// Month returns the first and the last day of the month containing day.
+func Month(day time.Time) (time.Time, time.Time) {
+	first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return first, first.AddDate(0, 1, -1)
+}
+
+// Status sums the charges of subs due in the month containing day against
+// b, for a user's budget only the user's share of them like the user's
+// total. subs must already be limited to the ones counting towards b, which
+// are all in the currency of b; otherwise it fails with
+// model.ErrMixedCurrencies.
+func Status(b *model.Budget, subs []*model.Subscription, day time.Time) (model.BudgetStatus, error) {
+	from, to := Month(day)
+	var spent model.Money
+	var err error
+	if b.UserID != "" {
+		spent, err = billing.ShareTotal(subs, b.UserID, from, to)
+	} else {
+		spent, err = billing.Total(subs, from, to)
+	}
+	if err != nil {
+		return model.BudgetStatus{}, err
+	}
+	if spent.Currency != "" && spent.Currency != b.Amount.Currency {
+		return model.BudgetStatus{}, model.ErrMixedCurrencies
+	}
+	st := model.BudgetStatus{
+		BudgetID: b.ID,
+		Month:    from.Format(monthLayout),
+		Amount:   b.Amount,
+		Spent:    model.Money{Currency: b.Amount.Currency}.Add(spent),
+	}
+	st.Remaining = st.Amount.Sub(st.Spent)
+	if b.Amount.Amount > 0 {
+		st.Utilisation = int(st.Spent.Amount * 100 / b.Amount.Amount)
+	}
+	for _, t := range Thresholds {
+		if st.Utilisation >= t {
+			st.Threshold = t
+		}
+	}
+	return st, nil
+}
+
+// Compute loads the subscriptions counting towards b and returns its status
+// for the month containing day.
+func Compute(ctx context.Context, repo repository.BudgetRepository, b *model.Budget, day time.Time) (model.BudgetStatus, error) {
+	from, to := Month(day)
+	subs, err := repo.Subscriptions(ctx, b, from, to)
+	if err != nil {
+		return model.BudgetStatus{}, err
+	}
+	return Status(b, subs, day)
+}
+
+type Alerts struct {
+	budgets repository.BudgetRepository
+	outbox  repository.WebhookRepository
+	zones   *zone.Resolver
+}
+
+func NewAlerts(budgets repository.BudgetRepository, outbox repository.WebhookRepository, zones *zone.Resolver) *Alerts {
+	return &Alerts{budgets: budgets, outbox: outbox, zones: zones}
+}
+
+// Check recomputes this month's status, in the zone of the budget's user or
+// organization, of every budget sub counts towards and writes a budget.threshold_reached event for each
+// threshold reached.
+// Each threshold is announced once per budget and month.
+func (a *Alerts) Check(ctx context.Context, sub *model.Subscription) error {
+	budgets, err := a.budgets.ForSubscription(ctx, sub)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, b := range budgets {
+		loc, err := a.zones.For(ctx, b.UserID, b.OrgID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		st, err := Compute(ctx, a.budgets, b, zone.Today(time.Now(), loc))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, t := range Thresholds {
+			if st.Utilisation < t {
+				break
+			}
+			key := "budget:" + b.ID + ":" + st.Month + ":" + strconv.Itoa(t)
+			alert := model.BudgetAlert{Budget: b, Status: st, SubscriptionID: sub.ID}
+			fresh, err := a.outbox.Enqueue(ctx, model.EventBudgetThreshold, b.OrgID, key, alert)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			if fresh {
+				logger.FromContext(ctx).Warnf("Budget %s reached %d%% in %s: spent %s of %s %s", b.ID, t, st.Month, st.Spent, st.Amount, st.Amount.Currency)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
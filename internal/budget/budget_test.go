@@ -0,0 +1,64 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+func rub(amount int64) model.Money {
+	return model.Money{Amount: amount, Currency: "RUB"}
+}
+
+func TestStatus(t *testing.T) {
+	b := &model.Budget{ID: "b1", Amount: rub(1000)}
+	subs := []*model.Subscription{
+		{ID: "monthly", Price: rub(300), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-10"},
+		{ID: "quarterly", Price: rub(600), BillingPeriod: model.BillingQuarterly, StartDate: "2025-12-20"},
+		{ID: "trial", Price: rub(500), BillingPeriod: model.BillingMonthly, StartDate: "2026-03-01", TrialEndDate: "2026-04-01"},
+	}
+	day, _ := time.Parse("2006-01-02", "2026-03-05")
+
+	// In March the monthly and quarterly subscriptions charge, the trial does not.
+	st, err := Status(b, subs, day)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	want := model.BudgetStatus{BudgetID: "b1", Month: "2026-03", Amount: rub(1000), Spent: rub(900), Remaining: rub(100), Utilisation: 90, Threshold: 80}
+	if st != want {
+		t.Errorf("Expected %+v, got %+v", want, st)
+	}
+
+	day, _ = time.Parse("2006-01-02", "2026-04-30")
+	if st, _ := Status(b, subs, day); st.Spent != rub(800) || st.Threshold != 80 {
+		t.Errorf("Expected 800 spent in April, got %+v", st)
+	}
+
+	b.Amount = rub(500)
+	if st, _ := Status(b, subs, day); st.Utilisation != 160 || st.Threshold != 100 || st.Remaining != rub(-300) {
+		t.Errorf("Expected an exceeded budget, got %+v", st)
+	}
+
+	subs = append(subs, &model.Subscription{ID: "euro", Price: model.Money{Amount: 100, Currency: "EUR"}, StartDate: "2026-01-01"})
+	if _, err := Status(b, subs, day); !errors.Is(err, model.ErrMixedCurrencies) {
+		t.Errorf("Expected ErrMixedCurrencies, got %v", err)
+	}
+}
+
+func TestStatusShares(t *testing.T) {
+	b := &model.Budget{ID: "b1", UserID: "member", Amount: rub(1000)}
+	subs := []*model.Subscription{
+		{ID: "family", UserID: "payer", Price: rub(900), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01",
+			Members: []model.Member{{UserID: "member", Weight: 2}}},
+		{ID: "own", UserID: "member", Price: rub(200), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-01",
+			Members: []model.Member{{UserID: "other", Amount: &model.Money{Amount: 50, Currency: "RUB"}}}},
+	}
+	day, _ := time.Parse("2006-01-02", "2026-03-05")
+
+	// The member pays 600 of the family plan and 150 of their own.
+	if st, _ := Status(b, subs, day); st.Spent != rub(750) || st.Utilisation != 75 || st.Threshold != 0 {
+		t.Errorf("Expected the member's share 750 to count, got %+v", st)
+	}
+}
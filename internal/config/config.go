@@ -1,23 +1,183 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Elmar006/subscription_service/internal/policy"
 )
 
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPass     string
-	DBName     string
-	ServerPort string
+	DatabaseURL string `yaml:"database_url"`
+	DBHost      string `yaml:"db_host"`
+	DBPort      string `yaml:"db_port"`
+	DBUser      string `yaml:"db_user"`
+	DBPass      string `yaml:"db_pass"`
+	DBName      string `yaml:"db_name"`
+	ServerPort  string `yaml:"server_port"`
+
+	TracingExporter string `yaml:"tracing_exporter"`
+	LogLevel        string `yaml:"log_level"`
+
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	DBMaxOpenConns    int           `yaml:"db_max_open_conns"`
+	DBMaxIdleConns    int           `yaml:"db_max_idle_conns"`
+	DBConnMaxLifetime time.Duration `yaml:"db_conn_max_lifetime"`
+
+	CORS CORSConfig `yaml:"cors"`
+
+	PublicPaths []string `yaml:"public_paths"`
+
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	JWT JWTConfig `yaml:"jwt"`
+
+	// Policies lists "action:scope" rules per role, see the policy package.
+	// DefaultRole is given to end users whose token carries no roles.
+	Policies    map[string][]string `yaml:"policies"`
+	DefaultRole string              `yaml:"default_role"`
+
+	Features map[string]bool `yaml:"features"`
+
+	Reminders RemindersConfig `yaml:"reminders"`
+
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+}
+
+// WebhooksConfig controls delivery of subscription events to registered
+// webhook endpoints. A delivery that still fails after MaxAttempts tries,
+// spaced by exponential backoff, is moved to the dead-letter state.
+type WebhooksConfig struct {
+	Interval    time.Duration `yaml:"interval"`
+	MaxAttempts int           `yaml:"max_attempts"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+// RemindersConfig controls the background job that warns about upcoming
+// charges, trial ends and end dates DaysBefore days ahead. Notifiers lists
+// where reminders go: log, smtp and webhook.
+type RemindersConfig struct {
+	DaysBefore int           `yaml:"days_before"`
+	Interval   time.Duration `yaml:"interval"`
+	Notifiers  []string      `yaml:"notifiers"`
+	SMTP       SMTPConfig    `yaml:"smtp"`
+	WebhookURL string        `yaml:"webhook_url"`
 }
 
-func Load() *Config {
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	To       string `yaml:"to"`
+}
+
+// JWTConfig enables bearer JWT authentication. HS256 tokens are checked
+// against Secret, RS256 tokens against the keys in JWKSFile or JWKSURL.
+type JWTConfig struct {
+	Secret     string `yaml:"secret"`
+	JWKSFile   string `yaml:"jwks_file"`
+	JWKSURL    string `yaml:"jwks_url"`
+	Issuer     string `yaml:"issuer"`
+	Audience   string `yaml:"audience"`
+	UserClaim  string `yaml:"user_claim"`
+	RolesClaim string `yaml:"roles_claim"`
+	AdminRole  string `yaml:"admin_role"`
+}
+
+// Enabled reports whether any JWT verification key is configured.
+func (j JWTConfig) Enabled() bool {
+	return j.Secret != "" || j.JWKSFile != "" || j.JWKSURL != ""
+}
+
+// RateLimitConfig sets per-client token buckets. Expensive endpoints such
+// as totals and exports have their own, smaller bucket, and every IP has
+// one checked before authentication. A rate of zero disables the
+// corresponding limiter.
+type RateLimitConfig struct {
+	RequestsPerMinute  int `yaml:"requests_per_minute"`
+	Burst              int `yaml:"burst"`
+	ExpensivePerMinute int `yaml:"expensive_per_minute"`
+	ExpensiveBurst     int `yaml:"expensive_burst"`
+	IPPerMinute        int `yaml:"ip_per_minute"`
+	IPBurst            int `yaml:"ip_burst"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+// Default returns the configuration used when neither the config file nor
+// the environment sets a value.
+func Default() *Config {
+	return &Config{
+		ServerPort:        "8080",
+		TracingExporter:   "none",
+		LogLevel:          "info",
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   15 * time.Second,
+		DBMaxOpenConns:    10,
+		DBMaxIdleConns:    5,
+		DBConnMaxLifetime: 30 * time.Minute,
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "X-Org-ID", "X-Request-ID"},
+		},
+		PublicPaths: []string{"/health", "/swagger/*"},
+		RateLimit: RateLimitConfig{
+			RequestsPerMinute:  600,
+			Burst:              60,
+			ExpensivePerMinute: 30,
+			ExpensiveBurst:     5,
+			IPPerMinute:        1200,
+			IPBurst:            120,
+		},
+		JWT: JWTConfig{
+			UserClaim:  "sub",
+			RolesClaim: "roles",
+			AdminRole:  "admin",
+		},
+		Policies:    policy.Default(),
+		DefaultRole: "editor",
+		Features:    map[string]bool{},
+		Reminders: RemindersConfig{
+			DaysBefore: 3,
+			Interval:   time.Hour,
+			Notifiers:  []string{"log"},
+			SMTP:       SMTPConfig{Port: "25"},
+		},
+		Webhooks: WebhooksConfig{
+			Interval:    10 * time.Second,
+			MaxAttempts: 8,
+			Timeout:     10 * time.Second,
+		},
+	}
+}
+
+// Load builds the configuration in layers: defaults, then the YAML file named
+// by CONFIG_FILE (if any), then environment variables and .env. All problems
+// are collected and returned together instead of stopping at the first one.
+func Load() (*Config, error) {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found in current directory, trying parent...")
 		if err := godotenv.Load("../.env"); err != nil {
@@ -25,19 +185,269 @@ func Load() *Config {
 		}
 	}
 
-	cfg := &Config{
-		DBHost:     MustGetEnv("DB_HOST"),
-		DBPort:     MustGetEnv("DB_PORT"),
-		DBUser:     MustGetEnv("DB_USER"),
-		DBPass:     MustGetEnv("DB_PASS"),
-		DBName:     MustGetEnv("DB_NAME"),
-		ServerPort: getEnv("SERVER_PORT", "8080"),
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	errs := cfg.applyEnv()
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides fields with the environment variables that are set.
+func (c *Config) applyEnv() []error {
+	var errs []error
+
+	setString(&c.DatabaseURL, "DATABASE_URL")
+	setString(&c.DBHost, "DB_HOST")
+	setString(&c.DBPort, "DB_PORT")
+	setString(&c.DBUser, "DB_USER")
+	setString(&c.DBPass, "DB_PASS")
+	setString(&c.DBName, "DB_NAME")
+	setString(&c.ServerPort, "SERVER_PORT")
+	setString(&c.TracingExporter, "TRACING_EXPORTER")
+	setString(&c.LogLevel, "LOG_LEVEL")
+
+	errs = appendErr(errs, setDuration(&c.ReadTimeout, "SERVER_READ_TIMEOUT"))
+	errs = appendErr(errs, setDuration(&c.WriteTimeout, "SERVER_WRITE_TIMEOUT"))
+	errs = appendErr(errs, setDuration(&c.IdleTimeout, "SERVER_IDLE_TIMEOUT"))
+	errs = appendErr(errs, setDuration(&c.ShutdownTimeout, "SERVER_SHUTDOWN_TIMEOUT"))
+
+	errs = appendErr(errs, setInt(&c.DBMaxOpenConns, "DB_MAX_OPEN_CONNS"))
+	errs = appendErr(errs, setInt(&c.DBMaxIdleConns, "DB_MAX_IDLE_CONNS"))
+	errs = appendErr(errs, setDuration(&c.DBConnMaxLifetime, "DB_CONN_MAX_LIFETIME"))
+
+	setList(&c.CORS.AllowedOrigins, "CORS_ALLOWED_ORIGINS")
+	setList(&c.CORS.AllowedMethods, "CORS_ALLOWED_METHODS")
+	setList(&c.CORS.AllowedHeaders, "CORS_ALLOWED_HEADERS")
+	setList(&c.PublicPaths, "AUTH_PUBLIC_PATHS")
+
+	errs = appendErr(errs, setInt(&c.RateLimit.RequestsPerMinute, "RATE_LIMIT_RPM"))
+	errs = appendErr(errs, setInt(&c.RateLimit.Burst, "RATE_LIMIT_BURST"))
+	errs = appendErr(errs, setInt(&c.RateLimit.ExpensivePerMinute, "RATE_LIMIT_EXPENSIVE_RPM"))
+	errs = appendErr(errs, setInt(&c.RateLimit.ExpensiveBurst, "RATE_LIMIT_EXPENSIVE_BURST"))
+	errs = appendErr(errs, setInt(&c.RateLimit.IPPerMinute, "RATE_LIMIT_IP_RPM"))
+	errs = appendErr(errs, setInt(&c.RateLimit.IPBurst, "RATE_LIMIT_IP_BURST"))
+
+	setString(&c.JWT.Secret, "JWT_SECRET")
+	setString(&c.JWT.JWKSFile, "JWT_JWKS_FILE")
+	setString(&c.JWT.JWKSURL, "JWT_JWKS_URL")
+	setString(&c.JWT.Issuer, "JWT_ISSUER")
+	setString(&c.JWT.Audience, "JWT_AUDIENCE")
+	setString(&c.JWT.UserClaim, "JWT_USER_CLAIM")
+	setString(&c.JWT.RolesClaim, "JWT_ROLES_CLAIM")
+	setString(&c.JWT.AdminRole, "JWT_ADMIN_ROLE")
+	setString(&c.DefaultRole, "DEFAULT_ROLE")
+
+	errs = appendErr(errs, setInt(&c.Reminders.DaysBefore, "REMINDER_DAYS_BEFORE"))
+	errs = appendErr(errs, setDuration(&c.Reminders.Interval, "REMINDER_INTERVAL"))
+	setList(&c.Reminders.Notifiers, "NOTIFIERS")
+	setString(&c.Reminders.SMTP.Host, "SMTP_HOST")
+	setString(&c.Reminders.SMTP.Port, "SMTP_PORT")
+	setString(&c.Reminders.SMTP.Username, "SMTP_USERNAME")
+	setString(&c.Reminders.SMTP.Password, "SMTP_PASSWORD")
+	setString(&c.Reminders.SMTP.From, "SMTP_FROM")
+	setString(&c.Reminders.SMTP.To, "SMTP_TO")
+	setString(&c.Reminders.WebhookURL, "NOTIFY_WEBHOOK_URL")
+	errs = appendErr(errs, setDuration(&c.Webhooks.Interval, "WEBHOOK_INTERVAL"))
+	errs = appendErr(errs, setInt(&c.Webhooks.MaxAttempts, "WEBHOOK_MAX_ATTEMPTS"))
+	errs = appendErr(errs, setDuration(&c.Webhooks.Timeout, "WEBHOOK_TIMEOUT"))
+
+	// FEATURES=name1,name2=false enables name1 and disables name2.
+	if val, ok := os.LookupEnv("FEATURES"); ok && val != "" {
+		if c.Features == nil {
+			c.Features = map[string]bool{}
+		}
+		for _, item := range splitList(val) {
+			name, enabled, found := strings.Cut(item, "=")
+			if !found {
+				c.Features[name] = true
+				continue
+			}
+			b, err := strconv.ParseBool(enabled)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("FEATURES: invalid value for %s: %q", name, enabled))
+				continue
+			}
+			c.Features[name] = b
+		}
+	}
+
+	return errs
+}
+
+// Validate checks the whole configuration and reports every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.DatabaseURL != "" {
+		u, err := url.Parse(c.DatabaseURL)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			errs = append(errs, errors.New("database_url must be a postgres:// URL"))
+		}
+	} else {
+		required := map[string]string{
+			"db_host": c.DBHost,
+			"db_port": c.DBPort,
+			"db_user": c.DBUser,
+			"db_pass": c.DBPass,
+			"db_name": c.DBName,
+		}
+		for _, key := range []string{"db_host", "db_port", "db_user", "db_pass", "db_name"} {
+			if required[key] == "" {
+				errs = append(errs, fmt.Errorf("%s is required when database_url is not set", key))
+			}
+		}
+	}
+
+	if c.DBPort != "" {
+		if err := validatePort(c.DBPort); err != nil {
+			errs = append(errs, fmt.Errorf("db_port: %w", err))
+		}
+	}
+	if err := validatePort(c.ServerPort); err != nil {
+		errs = append(errs, fmt.Errorf("server_port: %w", err))
+	}
+
+	switch c.TracingExporter {
+	case "none", "otlp", "stdout":
+	default:
+		errs = append(errs, fmt.Errorf("tracing_exporter must be one of none, otlp, stdout, got %q", c.TracingExporter))
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level must be one of debug, info, warn, error, got %q", c.LogLevel))
+	}
+
+	for name, d := range map[string]time.Duration{
+		"read_timeout":     c.ReadTimeout,
+		"write_timeout":    c.WriteTimeout,
+		"idle_timeout":     c.IdleTimeout,
+		"shutdown_timeout": c.ShutdownTimeout,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	if c.DBMaxOpenConns < 0 {
+		errs = append(errs, errors.New("db_max_open_conns must not be negative"))
+	}
+	if c.DBMaxIdleConns < 0 {
+		errs = append(errs, errors.New("db_max_idle_conns must not be negative"))
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("db_max_idle_conns must not exceed db_max_open_conns"))
+	}
+	if c.DBConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("db_conn_max_lifetime must not be negative"))
+	}
+
+	for name, rl := range map[string][2]int{
+		"rate_limit":           {c.RateLimit.RequestsPerMinute, c.RateLimit.Burst},
+		"rate_limit.expensive": {c.RateLimit.ExpensivePerMinute, c.RateLimit.ExpensiveBurst},
+		"rate_limit.ip":        {c.RateLimit.IPPerMinute, c.RateLimit.IPBurst},
+	} {
+		if rl[0] < 0 {
+			errs = append(errs, fmt.Errorf("%s: rate must not be negative", name))
+		}
+		if rl[0] > 0 && rl[1] < 1 {
+			errs = append(errs, fmt.Errorf("%s: burst must be at least 1", name))
+		}
+	}
+
+	if c.JWT.JWKSFile != "" && c.JWT.JWKSURL != "" {
+		errs = append(errs, errors.New("jwt.jwks_file and jwt.jwks_url are mutually exclusive"))
+	}
+	if c.JWT.JWKSURL != "" {
+		u, err := url.Parse(c.JWT.JWKSURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, errors.New("jwt.jwks_url must be an http(s) URL"))
+		}
+	}
+	if c.JWT.Enabled() && c.JWT.UserClaim == "" {
+		errs = append(errs, errors.New("jwt.user_claim must not be empty"))
+	}
+
+	if _, err := policy.New(c.Policies); err != nil {
+		errs = append(errs, fmt.Errorf("policies: %w", err))
+	}
+	if _, ok := c.Policies[c.DefaultRole]; !ok {
+		errs = append(errs, fmt.Errorf("default_role %q is not declared in policies", c.DefaultRole))
+	}
+
+	errs = append(errs, c.Reminders.validate()...)
+
+	if c.Webhooks.Interval <= 0 || c.Webhooks.Timeout <= 0 {
+		errs = append(errs, errors.New("webhooks.interval and webhooks.timeout must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhooks.max_attempts must be at least 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r RemindersConfig) validate() []error {
+	var errs []error
+
+	if r.DaysBefore < 0 {
+		errs = append(errs, errors.New("reminders.days_before must not be negative"))
+	}
+	if r.Interval <= 0 {
+		errs = append(errs, errors.New("reminders.interval must be positive"))
+	}
+	for _, n := range r.Notifiers {
+		switch n {
+		case "log":
+		case "smtp":
+			if r.SMTP.Host == "" || r.SMTP.From == "" || r.SMTP.To == "" {
+				errs = append(errs, errors.New("reminders.smtp: host, from and to are required for the smtp notifier"))
+			}
+			if err := validatePort(r.SMTP.Port); err != nil {
+				errs = append(errs, fmt.Errorf("reminders.smtp.port: %w", err))
+			}
+		case "webhook":
+			u, err := url.Parse(r.WebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				errs = append(errs, errors.New("reminders.webhook_url must be an http(s) URL for the webhook notifier"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("reminders.notifiers: unknown notifier %q, want log, smtp or webhook", n))
+		}
 	}
+	return errs
+}
 
-	return cfg
+// Feature reports whether the named feature flag is enabled.
+func (c *Config) Feature(name string) bool {
+	return c.Features[name]
 }
 
 func (c *Config) DBConnString() string {
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
 	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		c.DBHost,
@@ -48,17 +458,90 @@ func (c *Config) DBConnString() string {
 	)
 }
 
-func MustGetEnv(key string) string {
+// Print writes the effective configuration as YAML with secrets masked.
+func (c *Config) Print(w io.Writer) error {
+	masked := *c
+	if masked.DBPass != "" {
+		masked.DBPass = "****"
+	}
+	if masked.JWT.Secret != "" {
+		masked.JWT.Secret = "****"
+	}
+	if masked.Reminders.SMTP.Password != "" {
+		masked.Reminders.SMTP.Password = "****"
+	}
+	if masked.DatabaseURL != "" {
+		if u, err := url.Parse(masked.DatabaseURL); err == nil {
+			masked.DatabaseURL = u.Redacted()
+		} else {
+			masked.DatabaseURL = "****"
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	defer enc.Close()
+	return enc.Encode(&masked)
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func setString(dst *string, key string) {
+	if val, ok := os.LookupEnv(key); ok && val != "" {
+		*dst = val
+	}
+}
+
+func setList(dst *[]string, key string) {
+	if val, ok := os.LookupEnv(key); ok && val != "" {
+		*dst = splitList(val)
+	}
+}
+
+func setInt(dst *int, key string) error {
 	val, ok := os.LookupEnv(key)
 	if !ok || val == "" {
-		log.Fatalf("Required environment variable %s is not set", key)
+		return nil
 	}
-	return val
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return fmt.Errorf("%s: invalid integer %q", key, val)
+	}
+	*dst = n
+	return nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if val, ok := os.LookupEnv(key); ok && val != "" {
-		return val
+func setDuration(dst *time.Duration, key string) error {
+	val, ok := os.LookupEnv(key)
+	if !ok || val == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return fmt.Errorf("%s: invalid duration %q", key, val)
+	}
+	*dst = d
+	return nil
+}
+
+func splitList(val string) []string {
+	var out []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func appendErr(errs []error, err error) []error {
+	if err != nil {
+		return append(errs, err)
 	}
-	return defaultValue
+	return errs
 }
@@ -10,12 +10,15 @@ import (
 )
 
 func Connect(cfg *config.Config) *sql.DB {
-	logger.Init()
+	logger.Init(cfg.LogLevel)
 	log := logger.L()
 	db, err := sql.Open("postgres", cfg.DBConnString())
 	if err != nil {
 		log.Fatalf("Failed to open DB connection: %v", err)
 	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
 	if err := db.Ping(); err != nil {
 		log.Fatalf("Failed to ping DB: %v", err)
 	}
@@ -0,0 +1,105 @@
+// Package dedup finds subscriptions that pay for the same service more than
+// once at the same time.
+package dedup
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+// ServiceKey normalises a service name for comparison: case, surrounding
+// and repeated spaces are ignored. Subscriptions linked to the catalog
+// carry the canonical name, so aliases compare equal as well.
+func ServiceKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Overlap reports whether the date ranges of a and b share a day. An empty
+// end date means the subscription runs indefinitely.
+func Overlap(a, b *model.Subscription) bool {
+	return (a.EndDate == "" || b.StartDate <= a.EndDate) && (b.EndDate == "" || a.StartDate <= b.EndDate)
+}
+
+// Find groups subs that are for the same service and whose date ranges
+// overlap, directly or through another subscription of the group. With
+// perUser only subscriptions of the same user are compared; otherwise
+// every subscription in subs is, as for an organization. Groups are
+// ordered by service and user, their subscriptions by start date.
+func Find(subs []*model.Subscription, perUser bool) []model.DuplicateGroup {
+	type key struct{ user, service string }
+	byKey := map[key][]*model.Subscription{}
+	for _, sub := range subs {
+		k := key{service: ServiceKey(sub.ServiceName)}
+		if perUser {
+			k.user = sub.UserID
+		}
+		byKey[k] = append(byKey[k], sub)
+	}
+
+	var groups []model.DuplicateGroup
+	for k, list := range byKey {
+		if len(list) < 2 {
+			continue
+		}
+		sort.SliceStable(list, func(i, j int) bool { return list[i].StartDate < list[j].StartDate })
+
+		// Sorted by start, a subscription joins the current group when it
+		// starts before the latest end seen so far.
+		current := []*model.Subscription{list[0]}
+		end := list[0].EndDate
+		flush := func() {
+			if len(current) > 1 {
+				groups = append(groups, model.DuplicateGroup{
+					UserID:        k.user,
+					ServiceName:   current[0].ServiceName,
+					Subscriptions: current,
+				})
+			}
+		}
+		for _, sub := range list[1:] {
+			if end == "" || sub.StartDate <= end {
+				current = append(current, sub)
+				if end != "" && (sub.EndDate == "" || sub.EndDate > end) {
+					end = sub.EndDate
+				}
+				continue
+			}
+			flush()
+			current, end = []*model.Subscription{sub}, sub.EndDate
+		}
+		flush()
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := ServiceKey(groups[i].ServiceName), ServiceKey(groups[j].ServiceName)
+		if a != b {
+			return a < b
+		}
+		if groups[i].UserID != groups[j].UserID {
+			return groups[i].UserID < groups[j].UserID
+		}
+		return groups[i].Subscriptions[0].StartDate < groups[j].Subscriptions[0].StartDate
+	})
+	return groups
+}
+
+// Conflicts returns the subscriptions in existing that sub would duplicate:
+// same service, overlapping dates and neither cancelled nor expired.
+func Conflicts(sub *model.Subscription, existing []*model.Subscription) []*model.Subscription {
+	var out []*model.Subscription
+	service := ServiceKey(sub.ServiceName)
+	for _, other := range existing {
+		if other.ID == sub.ID || ServiceKey(other.ServiceName) != service {
+			continue
+		}
+		if other.Status == model.StatusCancelled || other.Status == model.StatusExpired {
+			continue
+		}
+		if Overlap(sub, other) {
+			out = append(out, other)
+		}
+	}
+	return out
+}
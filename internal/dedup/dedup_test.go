@@ -0,0 +1,53 @@
+package dedup
+
+import (
+	"testing"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+func TestFind(t *testing.T) {
+	subs := []*model.Subscription{
+		{ID: "a", UserID: "u1", ServiceName: "Notion", StartDate: "2026-01-01", EndDate: "2026-03-31"},
+		{ID: "b", UserID: "u1", ServiceName: " notion ", StartDate: "2026-03-15", EndDate: "2026-06-30"},
+		{ID: "c", UserID: "u1", ServiceName: "NOTION", StartDate: "2026-06-01"},
+		{ID: "d", UserID: "u1", ServiceName: "Notion", StartDate: "2025-01-01", EndDate: "2025-12-31"},
+		{ID: "e", UserID: "u2", ServiceName: "Notion", StartDate: "2026-02-01"},
+		{ID: "f", UserID: "u1", ServiceName: "Figma", StartDate: "2026-01-01"},
+	}
+
+	// Per user, a, b and c form one chain; d ended before a started.
+	groups := Find(subs, true)
+	if len(groups) != 1 || groups[0].UserID != "u1" || ids(groups[0]) != "abc" {
+		t.Fatalf("Unexpected groups %+v", groups)
+	}
+
+	// Across an organization, u2's subscription joins the chain.
+	groups = Find(subs, false)
+	if len(groups) != 1 || groups[0].UserID != "" || ids(groups[0]) != "aebc" {
+		t.Errorf("Unexpected organization groups %+v", groups)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	existing := []*model.Subscription{
+		{ID: "active", ServiceName: "Slack", StartDate: "2026-01-01", Status: model.StatusActive},
+		{ID: "cancelled", ServiceName: "Slack", StartDate: "2026-01-01", EndDate: "2026-12-31", Status: model.StatusCancelled},
+		{ID: "later", ServiceName: "Slack", StartDate: "2027-01-01", Status: model.StatusActive},
+		{ID: "other", ServiceName: "Zoom", StartDate: "2026-01-01", Status: model.StatusActive},
+	}
+	sub := &model.Subscription{ServiceName: "slack", StartDate: "2026-05-01", EndDate: "2026-08-31"}
+
+	got := Conflicts(sub, existing)
+	if len(got) != 1 || got[0].ID != "active" {
+		t.Errorf("Expected only the active subscription, got %+v", got)
+	}
+}
+
+func ids(g model.DuplicateGroup) string {
+	s := ""
+	for _, sub := range g.Subscriptions {
+		s += sub.ID
+	}
+	return s
+}
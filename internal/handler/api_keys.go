@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+type APIKeyHandler struct {
+	repo repository.APIKeyRepository
+}
+
+func NewAPIKeyHandler(repo repository.APIKeyRepository) *APIKeyHandler {
+	return &APIKeyHandler{repo: repo}
+}
+
+type IssueAPIKeyRequest struct {
+	Name      string   `json:"name" example:"billing-export"`
+	Scopes    []string `json:"scopes" example:"read,write"`
+	ExpiresIn string   `json:"expires_in,omitempty" example:"720h"`
+}
+
+type IssueAPIKeyResponse struct {
+	Key    string        `json:"key"`
+	APIKey *model.APIKey `json:"api_key"`
+}
+
+// IssueAPIKey godoc
+// @Summary Issue a new API key
+// @Description Creates an API key with the given scopes. The plain key is returned only once.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body IssueAPIKeyRequest true "Key name, scopes (read, write, admin) and optional lifetime"
+// @Success 201 {object} IssueAPIKeyResponse
+// @Failure 400 {string} string "Invalid request"
+// @Failure 500 {string} string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /admin/api-keys [post]
+func (s *APIKeyHandler) IssueAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req IssueAPIKeyRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Name == "" || len(req.Scopes) == 0 {
+		http.Error(w, "Invalid request, name and scopes are required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			http.Error(w, "Unknown scope "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid expires_in duration", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	plain, key, err := auth.Issue(r.Context(), s.repo, req.Name, req.Scopes, ttl)
+	if err != nil {
+		http.Error(w, "Failed to issue API key", http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("API key %s issued", key.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(IssueAPIKeyResponse{Key: plain, APIKey: key})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description Returns all API keys including revoked ones. Key values are never returned.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} model.APIKey
+// @Failure 500 {string} string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /admin/api-keys [get]
+func (s *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.repo.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Tags admin
+// @Param id path string true "API key ID"
+// @Success 204
+// @Failure 400 {string} string "Invalid id parameter"
+// @Failure 404 {string} string "API key not found"
+// @Security ApiKeyAuth
+// @Router /admin/api-keys/{id} [delete]
+func (s *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.repo.Revoke(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("API key %s revoked", idParam)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/policy"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// GetUserBalances godoc
+// @Summary Who owes whom for shared subscriptions
+// @Description The payer of a shared subscription pays every charge and each member owes the payer their share: a fixed amount, or a part by weight of what is left, the payer having weight 1 unless listed among the members. Debts over the period are netted per pair of users. The period is the current month by default.
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "User ID (UUID)"
+// @Param from query string false "Start date (YYYY-MM-DD, YYYY-MM or MM-YYYY)"
+// @Param to query string false "End date (YYYY-MM-DD, YYYY-MM or MM-YYYY), at most 5 years from today"
+// @Success 200 {object} model.Balances
+// @Failure 400 {string} string "Invalid date format"
+// @Failure 403 {string} string "Not allowed"
+// @Failure 422 {string} string "Subscriptions in different currencies"
+// @Failure 429 {string} string "Too many requests"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/balances [get]
+func (s *SubscriptionHandler) GetUserBalances(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	callerID, ok := s.authorize(w, r, policy.ActionTotal)
+	if !ok {
+		return
+	}
+	if callerID != "" && callerID != userID {
+		http.Error(w, "Cannot view balances of another user", http.StatusForbidden)
+		return
+	}
+
+	day := today(r.Context())
+	from := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := parseDate(v)
+		if err != nil {
+			http.Error(w, "Invalid 'from' date", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := parseEndDate(v)
+		if err != nil {
+			http.Error(w, "Invalid 'to' date", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if msg := windowError(from, to, day); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx := logger.WithFields(r.Context(), log.Fields{"user_id": userID})
+	subs, err := s.repo.ListInvolving(ctx, userID, nil, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	balances, err := billing.Balances(subs, userID, from, to)
+	if err != nil {
+		writeSumError(w, err)
+		return
+	}
+	if !s.fillCurrency(w, r, &userID, &balances.Owed, &balances.Owes) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balances)
+}
@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/budget"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/policy"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+	"github.com/Elmar006/subscription_service/internal/zone"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// BudgetHandler serves budgets. Access follows the subscription policy:
+// users with "own" rules manage their own budgets, organization-wide
+// budgets need "all".
+type BudgetHandler struct {
+	repo   repository.BudgetRepository
+	users  repository.UserRepository
+	zones  *zone.Resolver
+	policy *policy.Policy
+}
+
+func NewBudgetHandler(repo repository.BudgetRepository, users repository.UserRepository, zones *zone.Resolver, policy *policy.Policy) *BudgetHandler {
+	return &BudgetHandler{repo: repo, users: users, zones: zones, policy: policy}
+}
+
+// CreateBudget godoc
+// @Summary Create a monthly budget
+// @Description A budget belongs to user_id, or to the organization of the X-Org-ID header when user_id is empty. It covers all subscriptions, one service (service_name, aliases included) or one subscription category.
+// @Tags budgets
+// @Accept json
+// @Produce json
+// @Param budget body model.Budget true "Budget data"
+// @Success 201 {object} model.Budget
+// @Failure 400 {string} string "Invalid request"
+// @Failure 403 {string} string "Not allowed"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /budgets [post]
+func (s *BudgetHandler) CreateBudget(w http.ResponseWriter, r *http.Request) {
+	var b model.Budget
+	if !decodeJSON(w, r, &b) {
+		return
+	}
+
+	callerID, ok := checkPolicy(w, r, s.policy, policy.ActionCreate, "budgets")
+	if !ok {
+		return
+	}
+	if b.UserID == "" && tenant.OrgID(r.Context()) == "" {
+		b.UserID = callerID
+	}
+	switch {
+	case b.UserID == "" && tenant.OrgID(r.Context()) == "":
+		http.Error(w, "Invalid request, user_id or X-Org-ID is required", http.StatusBadRequest)
+		return
+	case b.UserID == "" && callerID != "":
+		http.Error(w, "Not allowed to create organization budgets", http.StatusForbidden)
+		return
+	case callerID != "" && b.UserID != callerID:
+		http.Error(w, "Not allowed to create budgets for other users", http.StatusForbidden)
+		return
+	}
+	if b.UserID != "" {
+		if _, err := uuid.Parse(b.UserID); err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+	}
+	currency := model.DefaultCurrency
+	if b.UserID != "" {
+		u, err := s.users.GetByID(r.Context(), b.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if u == nil {
+			http.Error(w, "Unknown user_id", http.StatusBadRequest)
+			return
+		}
+		currency = u.Currency
+	}
+	if msg := validateBudget(&b, currency); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	b.ID = uuid.New().String()
+	b.CreatedAt = time.Now()
+
+	if err := s.repo.Create(r.Context(), &b); err != nil {
+		if errors.Is(err, repository.ErrUnknownUser) {
+			http.Error(w, "Unknown user_id", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to create budget: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Budget %s created", b.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(b)
+}
+
+// ListBudgets godoc
+// @Summary List budgets
+// @Description Users limited to their own data only see their budgets
+// @Tags budgets
+// @Produce json
+// @Param user_id query string false "Only budgets of this user"
+// @Success 200 {array} model.Budget
+// @Failure 400 {string} string "Invalid user_id"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /budgets [get]
+func (s *BudgetHandler) ListBudgets(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := checkPolicy(w, r, s.policy, policy.ActionList, "budgets")
+	if !ok {
+		return
+	}
+
+	var userID *string
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		if _, err := uuid.Parse(v); err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		userID = &v
+	}
+	if callerID != "" {
+		userID = &callerID
+	}
+
+	budgets, err := s.repo.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budgets)
+}
+
+// GetBudget godoc
+// @Summary Get a budget by ID
+// @Tags budgets
+// @Produce json
+// @Param id path string true "Budget ID"
+// @Success 200 {object} model.Budget
+// @Failure 404 {string} string "Budget not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /budgets/{id} [get]
+func (s *BudgetHandler) GetBudget(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r, policy.ActionRead)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// UpdateBudget godoc
+// @Summary Update a budget
+// @Description Changes the amount, service_name and category. The owner of a budget cannot be changed.
+// @Tags budgets
+// @Accept json
+// @Produce json
+// @Param id path string true "Budget ID"
+// @Param budget body model.Budget true "Budget data"
+// @Success 200 {object} model.Budget
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Budget not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /budgets/{id} [put]
+func (s *BudgetHandler) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	existing, ok := s.loadBudget(w, r, policy.ActionUpdate)
+	if !ok {
+		return
+	}
+
+	var b model.Budget
+	if !decodeJSON(w, r, &b) {
+		return
+	}
+	b.ID, b.UserID, b.OrgID, b.CreatedAt = existing.ID, existing.UserID, existing.OrgID, existing.CreatedAt
+	if msg := validateBudget(&b, existing.Amount.Currency); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.repo.Update(r.Context(), &b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Budget %s updated", b.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// DeleteBudget godoc
+// @Summary Delete a budget
+// @Tags budgets
+// @Param id path string true "Budget ID"
+// @Success 204
+// @Failure 404 {string} string "Budget not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /budgets/{id} [delete]
+func (s *BudgetHandler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r, policy.ActionDelete)
+	if !ok {
+		return
+	}
+
+	if _, err := s.repo.Delete(r.Context(), b.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Budget %s deleted", b.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBudgetStatus godoc
+// @Summary Spend against a budget
+// @Description Sums the charges due in the month, as /subscriptions/total does, including charges later in the month. threshold is the highest alert threshold reached: 0, 80 or 100.
+// @Tags budgets
+// @Produce json
+// @Param id path string true "Budget ID"
+// @Param month query string false "Month as YYYY-MM, by default the current month in the zone of the budget's user or organization"
+// @Success 200 {object} model.BudgetStatus
+// @Failure 400 {string} string "Invalid month"
+// @Failure 404 {string} string "Budget not found"
+// @Failure 422 {string} string "Subscriptions in different currencies"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /budgets/{id}/status [get]
+func (s *BudgetHandler) GetBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	var day time.Time
+	if v := r.URL.Query().Get("month"); v != "" {
+		t, err := parseDate(v)
+		if err != nil {
+			http.Error(w, "Invalid month, use YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		day = t
+	}
+
+	b, ok := s.loadBudget(w, r, policy.ActionTotal)
+	if !ok {
+		return
+	}
+	if day.IsZero() {
+		loc, err := s.zones.For(r.Context(), b.UserID, b.OrgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		day = zone.Today(time.Now(), loc)
+	}
+	if windowError(day, day, today(r.Context())) != "" {
+		http.Error(w, "Invalid month, it must be at most 5 years from today", http.StatusBadRequest)
+		return
+	}
+
+	st, err := budget.Compute(r.Context(), s.repo, b, day)
+	if err != nil {
+		writeSumError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// loadBudget checks the policy for action and loads the budget named in
+// the path. Budgets of other users and organization budgets are reported
+// as not found to callers limited to their own data.
+func (s *BudgetHandler) loadBudget(w http.ResponseWriter, r *http.Request, action policy.Action) (*model.Budget, bool) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	callerID, ok := checkPolicy(w, r, s.policy, action, "budgets")
+	if !ok {
+		return nil, false
+	}
+
+	b, err := s.repo.GetByID(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if b == nil || (callerID != "" && b.UserID != callerID) {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return b, true
+}
+
+// validateBudget normalises the category of b, puts an amount given without
+// a currency into currency and returns an error message for an invalid
+// budget, or "".
+func validateBudget(b *model.Budget, currency string) string {
+	b.Category = repository.NormalizeLabel(b.Category)
+	if b.Amount.Currency != "" {
+		currency = b.Amount.Currency
+	}
+	if !validCurrency(currency) {
+		return "Invalid currency, use an ISO 4217 code such as RUB"
+	}
+	amount, err := b.Amount.In(currency)
+	if err != nil {
+		return "Invalid amount: " + err.Error()
+	}
+	b.Amount = amount
+	if b.Amount.Amount <= 0 {
+		return "amount must be positive"
+	}
+	if b.ServiceName != "" && b.Category != "" {
+		return "A budget covers either service_name or category, not both"
+	}
+	return ""
+}
@@ -1,47 +1,116 @@
 package handler
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/budget"
+	"github.com/Elmar006/subscription_service/internal/dedup"
+	"github.com/Elmar006/subscription_service/internal/lifecycle"
 	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/policy"
 	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+	"github.com/Elmar006/subscription_service/internal/zone"
 	"github.com/Elmar006/subscription_service/logger"
 	"github.com/google/uuid"
 )
 
 type SubscriptionHandler struct {
-	repo repository.SubscriptionRepository
+	repo     repository.SubscriptionRepository
+	services repository.ServiceRepository
+	plans    repository.PlanRepository
+	users    repository.UserRepository
+	alerts   *budget.Alerts
+	policy   *policy.Policy
+	// strictDuplicates rejects new subscriptions duplicating an active one
+	// instead of only warning about them.
+	strictDuplicates bool
 }
 
-func NewSubscriptionHandler(repo repository.SubscriptionRepository) *SubscriptionHandler {
-	return &SubscriptionHandler{repo: repo}
+func NewSubscriptionHandler(repo repository.SubscriptionRepository, services repository.ServiceRepository,
+	plans repository.PlanRepository, users repository.UserRepository, alerts *budget.Alerts, policy *policy.Policy, strictDuplicates bool) *SubscriptionHandler {
+	return &SubscriptionHandler{repo: repo, services: services, plans: plans, users: users, alerts: alerts, policy: policy,
+		strictDuplicates: strictDuplicates}
 }
 
 // @Summary Create a new subscription
-// @Description Create a new subscription with the input payload
+// @Description Create a new subscription with the input payload. user_id and the user_id of members must refer to existing users. The service is taken from service_id or resolved from service_name through the service catalog. With plan_id the service, price and billing period default to the plan's. A price given as a bare decimal is in the currency of the user. A subscription duplicating an active one of the same user (same service, overlapping dates) gets a Warning header, or is rejected with 409 when the strict_duplicates feature is enabled
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param subscription body model.Subscription true "Subscription data"
 // @Success 201 {object} model.Subscription
 // @Failure 400 {object} map[string]string
+// @Failure 409 {string} string "Duplicates an active subscription"
+// @Failure 413 {string} string "Request body too large"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /subscriptions [post]
 func (s *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
 	var sub model.Subscription
-	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &sub) {
 		return
 	}
-	defer r.Body.Close()
 
-	if sub.ServiceName == "" || sub.Price < 0 || sub.UserID == "" || sub.StartDate == "" {
+	callerID, ok := s.authorize(w, r, policy.ActionCreate)
+	if !ok {
+		return
+	}
+	if callerID != "" {
+		if sub.UserID == "" {
+			sub.UserID = callerID
+		} else if sub.UserID != callerID {
+			http.Error(w, "Cannot create subscriptions for another user", http.StatusForbidden)
+			return
+		}
+		// End users cannot pick the organization, it comes from their membership.
+		sub.OrgID = tenant.OrgID(r.Context())
+	}
+
+	if !s.applyPlan(w, r, &sub) || !s.resolveService(w, r, &sub) {
+		return
+	}
+
+	if sub.BillingPeriod == "" {
+		sub.BillingPeriod = model.BillingMonthly
+	}
+	if sub.ServiceName == "" || sub.Price.Amount < 0 || sub.UserID == "" || sub.StartDate == "" || model.BillingMonths(sub.BillingPeriod) == 0 {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	if !s.resolveCurrency(w, r, &sub, sub.Price.Currency) {
+		return
+	}
+	if msg := validateDates(&sub); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateTrial(&sub); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateLabels(&sub); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateMembers(&sub); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
 
 	sub.CreatedAt = time.Now()
 
@@ -49,40 +118,59 @@ func (s *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.
 		sub.ID = uuid.New().String()
 	}
 
-	if err := s.repo.Create(&sub); err != nil {
+	ctx := logger.WithFields(r.Context(), log.Fields{"user_id": sub.UserID, "subscription_id": sub.ID})
+	if !s.checkDuplicates(w, r.WithContext(ctx), &sub) {
+		return
+	}
+	if err := s.repo.Create(ctx, &sub); err != nil {
+		if errors.Is(err, repository.ErrUnknownUser) {
+			http.Error(w, "Unknown user_id or member user_id", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to create subscription: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	logger.FromContext(ctx).Info("Subscription created successfully")
+	s.checkBudgets(ctx, &sub)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(sub)
 }
 
 // @Summary Get subscription by ID
-// @Description Get subscription by ID
+// @Description Get subscription by ID, including the computed next_charge_date
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param id path string true "Subscription ID"
 // @Success 200 {object} model.Subscription
 // @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /subscriptions/{id} [get]
 func (s *SubscriptionHandler) GetByIDSubscription(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionRead)
+	if !ok {
+		return
+	}
+
 	idParam := chi.URLParam(r, "id")
 	if idParam == "" {
 		http.Error(w, "Invalid id parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	sub, err := s.repo.GetByID(idParam)
+	ctx := logger.WithFields(r.Context(), log.Fields{"subscription_id": idParam})
+	sub, err := s.repo.GetByID(ctx, idParam)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if sub == nil {
+	if sub == nil || !ownedBy(sub, callerID) {
 		http.Error(w, "subscription not found", http.StatusNotFound)
 		return
 	}
+	setNextCharge(r.Context(), sub)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(sub)
@@ -90,27 +178,47 @@ func (s *SubscriptionHandler) GetByIDSubscription(w http.ResponseWriter, r *http
 
 // GetSubscription godoc
 // @Summary List all subscriptions for a user
-// @Description Returns all subscriptions belonging to a specific user
+// @Description Returns all subscriptions belonging to a specific user, including the computed next_charge_date
 // @Tags subscriptions
 // @Accept  json
 // @Produce  json
-// @Param user_id query string true "User ID (UUID)"
+// @Param user_id query string false "User ID (UUID), defaults to the caller for user tokens"
+// @Param tag query string false "Only subscriptions with this tag"
+// @Param category query string false "Only subscriptions in this category"
 // @Success 200 {array} model.Subscription
 // @Failure 400 {string} string "Invalid user_id parameter is required"
 // @Failure 500 {string} string "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /subscriptions [get]
 func (s *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionList)
+	if !ok {
+		return
+	}
+
 	userIDStr := r.URL.Query().Get("user_id")
+	if callerID != "" {
+		if userIDStr == "" {
+			userIDStr = callerID
+		} else if userIDStr != callerID {
+			http.Error(w, "Cannot list subscriptions of another user", http.StatusForbidden)
+			return
+		}
+	}
 	if userIDStr == "" {
 		http.Error(w, "Invalid user_id parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	sub, err := s.repo.ListByUser(userIDStr)
+	ctx := logger.WithFields(r.Context(), log.Fields{"user_id": userIDStr})
+	sub, err := s.repo.ListByUser(ctx, userIDStr)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	sub = filterLabels(sub, r.URL.Query().Get("tag"), r.URL.Query().Get("category"))
+	setNextCharge(r.Context(), sub...)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(sub)
@@ -126,36 +234,89 @@ func (s *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Req
 // @Success 200 {object} model.Subscription
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {string} string "Currency change with amounts left in the old currency"
+// @Failure 413 {string} string "Request body too large"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /subscriptions/{id} [put]
 func (s *SubscriptionHandler) UpdateByIDSubscription(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionUpdate)
+	if !ok {
+		return
+	}
+
 	idParam := chi.URLParam(r, "id")
 	if idParam == "" {
 		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
 		return
 	}
 
-	existing, err := s.repo.GetByID(idParam)
+	ctx := logger.WithFields(r.Context(), log.Fields{"subscription_id": idParam})
+	existing, err := s.repo.GetByID(ctx, idParam)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if existing == nil {
+	if existing == nil || !ownedBy(existing, callerID) {
 		http.Error(w, "Subscription not found", http.StatusNotFound)
 		return
 	}
+	ctx = logger.WithFields(ctx, log.Fields{"user_id": existing.UserID})
 
 	var sub model.Subscription
-	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &sub) {
 		return
 	}
-	defer r.Body.Close()
 
-	if sub.ServiceName != "" {
+	if sub.ServiceName != "" || sub.ServiceID != "" {
 		existing.ServiceName = sub.ServiceName
+		existing.ServiceID = sub.ServiceID
+		if !s.resolveService(w, r, existing) {
+			return
+		}
 	}
-	if sub.Price >= 0 {
+	stored := existing.Price.Currency
+	currency := stored
+	if !sub.Price.IsZero() {
+		if sub.Price.Amount < 0 {
+			http.Error(w, "Invalid price", http.StatusBadRequest)
+			return
+		}
 		existing.Price = sub.Price
+		if sub.Price.Currency != "" {
+			currency = sub.Price.Currency
+		}
+	}
+	if sub.BillingPeriod != "" {
+		existing.BillingPeriod = sub.BillingPeriod
+	}
+	if sub.PlanID != "" && sub.PlanID != existing.PlanID {
+		// What the request does not set comes from the new plan, not the
+		// old one; an intro offer does not carry over to another plan.
+		existing.PlanID = sub.PlanID
+		existing.ServiceID = ""
+		if sub.BillingPeriod == "" {
+			existing.BillingPeriod = ""
+		}
+		if sub.Price.IsZero() {
+			existing.Price = model.Money{}
+		}
+		if sub.IntroPrice == nil {
+			existing.IntroPrice = nil
+		}
+		if sub.IntroMonths == 0 {
+			existing.IntroMonths = 0
+		}
+		if !s.applyPlan(w, r, existing) || !s.resolveService(w, r, existing) {
+			return
+		}
+		if sub.Price.IsZero() {
+			currency = existing.Price.Currency
+		}
+	}
+	if model.BillingMonths(existing.BillingPeriod) == 0 {
+		http.Error(w, "Invalid billing_period", http.StatusBadRequest)
+		return
 	}
 	if sub.StartDate != "" {
 		existing.StartDate = sub.StartDate
@@ -163,30 +324,81 @@ func (s *SubscriptionHandler) UpdateByIDSubscription(w http.ResponseWriter, r *h
 	if sub.EndDate != "" {
 		existing.EndDate = sub.EndDate
 	}
+	if sub.TrialEndDate != "" {
+		existing.TrialEndDate = sub.TrialEndDate
+	}
+	if sub.IntroPrice != nil {
+		existing.IntroPrice = sub.IntroPrice
+	}
+	if sub.IntroMonths > 0 {
+		existing.IntroMonths = sub.IntroMonths
+	}
+	if sub.Category != "" {
+		existing.Category = sub.Category
+	}
+	if sub.Tags != nil {
+		existing.Tags = sub.Tags
+	}
+	if sub.Members != nil {
+		existing.Members = sub.Members
+	}
+	if msg := currencyConflict(existing, stored, currency); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	if !s.resolveCurrency(w, r, existing, currency) {
+		return
+	}
+	if msg := validateDates(existing); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateLabels(existing); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateMembers(existing); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateTrial(existing); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
 
-	if err := s.repo.Update(existing); err != nil {
+	if err := s.repo.Update(ctx, existing); err != nil {
+		if errors.Is(err, repository.ErrUnknownUser) {
+			http.Error(w, "Unknown member user_id", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	logger.L().Info("Subscription updated successfully")
+	logger.FromContext(ctx).Info("Subscription updated successfully")
+	s.checkBudgets(ctx, existing)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(existing)
 }
 
 // GetSubscriptionTotal godoc
 // @Summary Get total price of subscriptions
-// @Description Returns the total sum of subscriptions for a user with optional filters
+// @Description Returns the sum of all charges due between from and to for a user with optional filters. Subscriptions charge every billing period from their start, or from the trial end when they have a trial; intro prices apply during the intro period. With user_id only the user's share of the subscriptions they pay for or are a member of counts. Subscriptions in different currencies are not added up
 // @Tags subscriptions
 // @Accept  json
 // @Produce  json
 // @Param user_id query string false "User ID (UUID)"
 // @Param service_name query string false "Service name filter"
-// @Param from query string false "Start date filter (YYYY-MM-DD)"
-// @Param to query string false "End date filter (YYYY-MM-DD)"
-// @Success 200 {object} map[string]int "Returns total as JSON {\"total\":123}"
+// @Param from query string false "Start date filter (YYYY-MM-DD, or a month as YYYY-MM or MM-YYYY meaning its first day)"
+// @Param to query string false "End date filter (YYYY-MM-DD, or a month as YYYY-MM or MM-YYYY meaning its last day), at most 5 years from today"
+// @Param group_by query string false "Also sum per tag or per category" Enums(tag, category)
+// @Success 200 {object} model.Total "Returns total as JSON {\"total\":{\"amount\":\"123.00\",\"currency\":\"RUB\"}}"
 // @Failure 400 {string} string "Invalid date format"
+// @Failure 422 {string} string "Subscriptions in different currencies"
+// @Failure 429 {string} string "Too many requests"
 // @Failure 500 {string} string "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /subscriptions/total [get]
 func (s *SubscriptionHandler) GetSubscriptionTotal(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
@@ -195,6 +407,24 @@ func (s *SubscriptionHandler) GetSubscriptionTotal(w http.ResponseWriter, r *htt
 	serviceNameStr := q.Get("service_name")
 	fromStr := q.Get("from")
 	toStr := q.Get("to")
+	groupBy := q.Get("group_by")
+	if groupBy != "" && groupBy != "tag" && groupBy != "category" {
+		http.Error(w, "Invalid group_by, use tag or category", http.StatusBadRequest)
+		return
+	}
+
+	callerID, ok := s.authorize(w, r, policy.ActionTotal)
+	if !ok {
+		return
+	}
+	if callerID != "" {
+		if userIDStr == "" {
+			userIDStr = callerID
+		} else if userIDStr != callerID {
+			http.Error(w, "Cannot calculate totals of another user", http.StatusForbidden)
+			return
+		}
+	}
 
 	var userIDPtr *string
 	if userIDStr != "" {
@@ -220,24 +450,84 @@ func (s *SubscriptionHandler) GetSubscriptionTotal(w http.ResponseWriter, r *htt
 
 	var to time.Time
 	if toStr != "" {
-		t, err := parseDate(toStr)
+		t, err := parseEndDate(toStr)
 		if err != nil {
 			http.Error(w, "Invalid 'to' date", http.StatusBadRequest)
 			return
 		}
 		to = t
 	} else {
-		to = time.Now()
+		to = today(r.Context())
+	}
+	if msg := windowError(from, to, today(r.Context())); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if userIDPtr != nil {
+		ctx = logger.WithFields(ctx, log.Fields{"user_id": *userIDPtr})
 	}
 
-	total, err := s.repo.Total(userIDPtr, serviceNamePtr, from, to)
+	if groupBy == "" {
+		total, err := s.repo.Total(ctx, userIDPtr, serviceNamePtr, from, to)
+		if err != nil {
+			writeSumError(w, err)
+			return
+		}
+		if !s.fillCurrency(w, r, userIDPtr, &total) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.Total{Total: total})
+		return
+	}
+
+	// As in repo.Total, a single user only pays their share.
+	sum := func(subs []*model.Subscription) (model.Money, error) { return billing.Total(subs, from, to) }
+	var subs []*model.Subscription
+	var err error
+	if userIDPtr != nil {
+		subs, err = s.repo.ListInvolving(ctx, *userIDPtr, serviceNamePtr, from, to)
+		sum = func(subs []*model.Subscription) (model.Money, error) {
+			return billing.ShareTotal(subs, *userIDPtr, from, to)
+		}
+	} else {
+		subs, err = s.repo.ListBetween(ctx, nil, serviceNamePtr, from, to)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	byLabel := map[string][]*model.Subscription{}
+	for _, sub := range subs {
+		for _, label := range groupLabels(sub, groupBy) {
+			byLabel[label] = append(byLabel[label], sub)
+		}
+	}
+	total, err := sum(subs)
+	if err != nil {
+		writeSumError(w, err)
+		return
+	}
+	if !s.fillCurrency(w, r, userIDPtr, &total) {
+		return
+	}
+	res := model.Total{Total: total, Groups: []model.GroupTotal{}}
+	for label, group := range byLabel {
+		groupTotal, err := sum(group)
+		if err != nil {
+			writeSumError(w, err)
+			return
+		}
+		res.Groups = append(res.Groups, model.GroupTotal{Name: label, Total: groupTotal})
+	}
+	sort.Slice(res.Groups, func(i, j int) bool { return res.Groups[i].Name < res.Groups[j].Name })
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"total": total})
+	json.NewEncoder(w).Encode(res)
 }
 
 // @Summary Delete subscription by ID
@@ -248,37 +538,1031 @@ func (s *SubscriptionHandler) GetSubscriptionTotal(w http.ResponseWriter, r *htt
 // @Param id path string true "Subscription ID"
 // @Success 204
 // @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /subscriptions/{id} [delete]
 func (s *SubscriptionHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionDelete)
+	if !ok {
+		return
+	}
+
 	idParam := chi.URLParam(r, "id")
 	if idParam == "" {
 		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
 		return
 	}
 
-	subCheck, err := s.repo.GetByID(idParam)
+	ctx := logger.WithFields(r.Context(), log.Fields{"subscription_id": idParam})
+	subCheck, err := s.repo.GetByID(ctx, idParam)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if subCheck == nil {
-		logger.L().Error("The subscription you want to delete does not exist")
+	if subCheck == nil || !ownedBy(subCheck, callerID) {
+		logger.FromContext(ctx).Error("The subscription you want to delete does not exist")
 		http.Error(w, "Subscription not found", http.StatusNotFound)
 		return
 	}
 
-	if err := s.repo.Delete(idParam); err != nil {
+	ctx = logger.WithFields(ctx, log.Fields{"user_id": subCheck.UserID})
+	if err := s.repo.Delete(ctx, idParam); err != nil {
 		http.Error(w, "Error deleting an entry", http.StatusInternalServerError)
 		return
 	}
 
-	logger.L().Info("Subscription record successfully deleted")
+	logger.FromContext(ctx).Info("Subscription record successfully deleted")
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func parseDate(date string) (time.Time, error) {
-	if len(date) == 7 {
-		return time.Parse("2006-01", date)
+// ExportSubscriptions godoc
+// @Summary Export subscriptions as CSV
+// @Description Returns all subscriptions visible to the caller, optionally only those of one user
+// @Tags subscriptions
+// @Produce text/csv
+// @Param user_id query string false "User ID (UUID)"
+// @Success 200 {string} string "CSV file"
+// @Failure 403 {string} string "Not allowed"
+// @Failure 429 {string} string "Too many requests"
+// @Failure 500 {string} string "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/export [get]
+func (s *SubscriptionHandler) ExportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionExport)
+	if !ok {
+		return
+	}
+
+	var userIDPtr *string
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		userIDPtr = &userIDStr
+	}
+	if callerID != "" {
+		if userIDPtr != nil && *userIDPtr != callerID {
+			http.Error(w, "Cannot export subscriptions of another user", http.StatusForbidden)
+			return
+		}
+		userIDPtr = &callerID
+	}
+
+	subs, err := s.repo.ListAll(r.Context(), userIDPtr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "service_name", "service_id", "plan_id", "price", "currency", "billing_period", "user_id", "org_id",
+		"start_date", "end_date", "trial_end_date", "intro_price", "intro_months", "status", "category", "tags", "created_at"})
+	for _, sub := range subs {
+		introPrice := ""
+		if sub.IntroPrice != nil {
+			introPrice = sub.IntroPrice.String()
+		}
+		cw.Write([]string{
+			sub.ID, sub.ServiceName, sub.ServiceID, sub.PlanID, sub.Price.String(), sub.Price.Currency, sub.BillingPeriod, sub.UserID, sub.OrgID,
+			string(sub.StartDate), string(sub.EndDate), string(sub.TrialEndDate), introPrice, strconv.Itoa(sub.IntroMonths), sub.Status,
+			sub.Category, strings.Join(sub.Tags, ";"), sub.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	cw.Flush()
+}
+
+// GetTrialsEnding godoc
+// @Summary List trials about to convert to paid
+// @Description Returns subscriptions whose trial ends between today and today plus within
+// @Tags subscriptions
+// @Produce json
+// @Param within query string false "Look-ahead window such as 7d or 48h, 7d by default"
+// @Param user_id query string false "User ID (UUID), defaults to the caller for user tokens"
+// @Success 200 {array} model.Subscription
+// @Failure 400 {string} string "Invalid within parameter"
+// @Failure 403 {string} string "Not allowed"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/trials/ending [get]
+func (s *SubscriptionHandler) GetTrialsEnding(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionList)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	within := 7 * 24 * time.Hour
+	if withinStr := q.Get("within"); withinStr != "" {
+		d, err := parseWithin(withinStr)
+		if err != nil || d < 0 {
+			http.Error(w, "Invalid within parameter", http.StatusBadRequest)
+			return
+		}
+		within = d
+	}
+
+	var userIDPtr *string
+	if userIDStr := q.Get("user_id"); userIDStr != "" {
+		userIDPtr = &userIDStr
+	}
+	if callerID != "" {
+		if userIDPtr != nil && *userIDPtr != callerID {
+			http.Error(w, "Cannot list trials of another user", http.StatusForbidden)
+			return
+		}
+		userIDPtr = &callerID
+	}
+
+	today := today(r.Context())
+	subs, err := s.repo.ListTrialsEnding(r.Context(), userIDPtr, today, today.Add(within))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []*model.Subscription{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+// GetUpcomingCharges godoc
+// @Summary Projected payment schedule
+// @Description Returns every charge due between from and to, ordered by date
+// @Tags subscriptions
+// @Produce json
+// @Param user_id query string false "User ID (UUID), defaults to the caller for user tokens"
+// @Param from query string false "First day of the window (YYYY-MM-DD, YYYY-MM or MM-YYYY), today by default"
+// @Param to query string false "Last day of the window (YYYY-MM-DD, YYYY-MM or MM-YYYY), one month after from by default"
+// @Success 200 {array} model.ChargeEvent
+// @Failure 400 {string} string "Invalid date format"
+// @Failure 403 {string} string "Not allowed"
+// @Failure 429 {string} string "Too many requests"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/upcoming [get]
+func (s *SubscriptionHandler) GetUpcomingCharges(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionList)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var userIDPtr *string
+	if userIDStr := q.Get("user_id"); userIDStr != "" {
+		userIDPtr = &userIDStr
+	}
+	if callerID != "" {
+		if userIDPtr != nil && *userIDPtr != callerID {
+			http.Error(w, "Cannot list charges of another user", http.StatusForbidden)
+			return
+		}
+		userIDPtr = &callerID
+	}
+
+	from := today(r.Context())
+	if fromStr := q.Get("from"); fromStr != "" {
+		t, err := parseDate(fromStr)
+		if err != nil {
+			http.Error(w, "Invalid 'from' date", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	to := billing.AddMonths(from, 1)
+	if toStr := q.Get("to"); toStr != "" {
+		t, err := parseEndDate(toStr)
+		if err != nil {
+			http.Error(w, "Invalid 'to' date", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if to.Before(from) || to.After(billing.AddMonths(from, maxScheduleMonths)) {
+		http.Error(w, "Invalid window, 'to' must be after 'from' and at most 5 years later", http.StatusBadRequest)
+		return
+	}
+
+	subs, err := s.repo.ListBetween(r.Context(), userIDPtr, nil, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events := []model.ChargeEvent{}
+	for _, sub := range subs {
+		for _, c := range billing.Charges(sub, from, to) {
+			events = append(events, model.ChargeEvent{
+				SubscriptionID: sub.ID,
+				ServiceName:    sub.ServiceName,
+				UserID:         sub.UserID,
+				Date:           model.DateOf(c.Date),
+				Amount:         c.Amount,
+			})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date < events[j].Date })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// GetSubscriptionForecast godoc
+// @Summary Spending forecast
+// @Description Projects the spend per calendar month, starting with the current one, from the subscriptions running in that time: their billing periods, trials, intro prices, end dates, pauses and scheduled price changes. Within an organization (X-Org-ID) the forecast covers the organization. A user's forecast, and each forecast of group_by=user, counts only the user's share of the subscriptions they pay for or are a member of, like the total.
+// @Tags subscriptions
+// @Produce json
+// @Param user_id query string false "User ID (UUID), defaults to the caller for user tokens"
+// @Param months query int false "Number of months, 12 by default, at most 60"
+// @Param group_by query string false "user to add a forecast per user"
+// @Success 200 {object} model.Forecast
+// @Failure 400 {string} string "Invalid months or group_by"
+// @Failure 403 {string} string "Not allowed"
+// @Failure 422 {string} string "Subscriptions in different currencies"
+// @Failure 429 {string} string "Too many requests"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/forecast [get]
+func (s *SubscriptionHandler) GetSubscriptionForecast(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionTotal)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var userIDPtr *string
+	if userIDStr := q.Get("user_id"); userIDStr != "" {
+		if _, err := uuid.Parse(userIDStr); err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		userIDPtr = &userIDStr
+	}
+	if callerID != "" {
+		if userIDPtr != nil && *userIDPtr != callerID {
+			http.Error(w, "Cannot forecast another user's subscriptions", http.StatusForbidden)
+			return
+		}
+		userIDPtr = &callerID
+	}
+
+	months := 12
+	if v := q.Get("months"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxScheduleMonths {
+			http.Error(w, "Invalid months, must be between 1 and 60", http.StatusBadRequest)
+			return
+		}
+		months = n
+	}
+	groupBy := q.Get("group_by")
+	if groupBy != "" && groupBy != "user" {
+		http.Error(w, "Invalid group_by, only user is supported", http.StatusBadRequest)
+		return
+	}
+
+	from := today(r.Context())
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, months, -1)
+
+	// A user's forecast, like their total, is their share of the
+	// subscriptions they pay for or are a member of.
+	var subs []*model.Subscription
+	var err error
+	if userIDPtr != nil {
+		subs, err = s.repo.ListInvolving(r.Context(), *userIDPtr, nil, first, last)
+	} else {
+		subs, err = s.repo.ListBetween(r.Context(), nil, nil, first, last)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var forecast model.Forecast
+	if userIDPtr != nil {
+		forecast.Months, forecast.Total, err = billing.ShareForecast(subs, *userIDPtr, from, months)
+	} else {
+		forecast.Months, forecast.Total, err = billing.Forecast(subs, from, months)
+	}
+	if err != nil {
+		writeSumError(w, err)
+		return
+	}
+	if groupBy == "user" {
+		var users []string
+		if userIDPtr != nil {
+			users = []string{*userIDPtr}
+		} else {
+			seen := map[string]bool{}
+			add := func(userID string) {
+				if !seen[userID] {
+					seen[userID] = true
+					users = append(users, userID)
+				}
+			}
+			for _, sub := range subs {
+				add(sub.UserID)
+				for _, m := range sub.Members {
+					add(m.UserID)
+				}
+			}
+			sort.Strings(users)
+		}
+		forecast.Users = []model.UserForecast{}
+		for _, userID := range users {
+			uf := model.UserForecast{UserID: userID}
+			uf.Months, uf.Total, err = billing.ShareForecast(subs, userID, from, months)
+			if err != nil {
+				writeSumError(w, err)
+				return
+			}
+			forecast.Users = append(forecast.Users, uf)
+		}
+	}
+	amounts := []*model.Money{&forecast.Total}
+	for i := range forecast.Months {
+		amounts = append(amounts, &forecast.Months[i].Amount)
+	}
+	for i := range forecast.Users {
+		amounts = append(amounts, &forecast.Users[i].Total)
+		for j := range forecast.Users[i].Months {
+			amounts = append(amounts, &forecast.Users[i].Months[j].Amount)
+		}
+	}
+	if !s.fillCurrency(w, r, userIDPtr, amounts...) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forecast)
+}
+
+// GetDuplicateSubscriptions godoc
+// @Summary Find duplicate subscriptions
+// @Description Groups subscriptions to the same service, compared by normalised name, whose date ranges overlap. Subscriptions are compared per user, or across the whole organization of the X-Org-ID header when no user is given
+// @Tags subscriptions
+// @Produce json
+// @Param user_id query string false "User ID (UUID), defaults to the caller for user tokens"
+// @Success 200 {array} model.DuplicateGroup
+// @Failure 400 {string} string "Invalid user_id"
+// @Failure 403 {string} string "Not allowed"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/duplicates [get]
+func (s *SubscriptionHandler) GetDuplicateSubscriptions(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionList)
+	if !ok {
+		return
+	}
+
+	var userIDPtr *string
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		if _, err := uuid.Parse(userIDStr); err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		userIDPtr = &userIDStr
+	}
+	if callerID != "" {
+		if userIDPtr != nil && *userIDPtr != callerID {
+			http.Error(w, "Cannot list subscriptions of another user", http.StatusForbidden)
+			return
+		}
+		userIDPtr = &callerID
+	}
+
+	subs, err := s.repo.ListAll(r.Context(), userIDPtr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	perUser := userIDPtr != nil || tenant.OrgID(r.Context()) == ""
+	groups := dedup.Find(subs, perUser)
+	if groups == nil {
+		groups = []model.DuplicateGroup{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// PauseSubscription godoc
+// @Summary Pause a subscription
+// @Description Pauses an active or trial subscription from today. Charges falling into the pause are not counted in totals
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} model.Subscription
+// @Failure 404 {string} string "Subscription not found"
+// @Failure 409 {string} string "Transition not allowed in the current status"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/{id}/pause [post]
+func (s *SubscriptionHandler) PauseSubscription(w http.ResponseWriter, r *http.Request) {
+	s.changeStatus(w, r, lifecycle.ActionPause)
+}
+
+// ResumeSubscription godoc
+// @Summary Resume a paused subscription
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} model.Subscription
+// @Failure 404 {string} string "Subscription not found"
+// @Failure 409 {string} string "Transition not allowed in the current status"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/{id}/resume [post]
+func (s *SubscriptionHandler) ResumeSubscription(w http.ResponseWriter, r *http.Request) {
+	s.changeStatus(w, r, lifecycle.ActionResume)
+}
+
+// CancelSubscription godoc
+// @Summary Cancel a subscription
+// @Description By default the subscription runs until the end of the period already paid for. With immediate=true it ends today
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param immediate query bool false "End the subscription today instead of at the end of the billing period"
+// @Success 200 {object} model.Subscription
+// @Failure 404 {string} string "Subscription not found"
+// @Failure 409 {string} string "Transition not allowed in the current status"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions/{id}/cancel [post]
+func (s *SubscriptionHandler) CancelSubscription(w http.ResponseWriter, r *http.Request) {
+	s.changeStatus(w, r, lifecycle.ActionCancel)
+}
+
+// changeStatus applies a lifecycle action to the subscription in the id URL
+// parameter and responds with the updated subscription.
+func (s *SubscriptionHandler) changeStatus(w http.ResponseWriter, r *http.Request, action lifecycle.Action) {
+	callerID, ok := s.authorize(w, r, policy.ActionUpdate)
+	if !ok {
+		return
+	}
+
+	idParam := chi.URLParam(r, "id")
+	ctx := logger.WithFields(r.Context(), log.Fields{"subscription_id": idParam})
+	sub, err := s.repo.GetByID(ctx, idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sub == nil || !ownedBy(sub, callerID) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	ctx = logger.WithFields(ctx, log.Fields{"user_id": sub.UserID})
+
+	to, err := lifecycle.Next(sub.Status, action)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	effective := today(r.Context())
+	if action == lifecycle.ActionCancel {
+		immediate := r.URL.Query().Get("immediate") == "true"
+		effective = lifecycle.CancelEndDate(sub, effective, immediate)
+		sub.EndDate = model.DateOf(effective)
+	}
+
+	updated, err := s.repo.Transition(ctx, sub, to, effective)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Subscription status changed concurrently, retry", http.StatusConflict)
+		return
+	}
+
+	sub, err = s.repo.GetByID(ctx, idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setNextCharge(r.Context(), sub)
+	logger.FromContext(ctx).Infof("Subscription status changed to %s", sub.Status)
+	if action == lifecycle.ActionResume {
+		s.checkBudgets(ctx, sub)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// PurgeSubscriptions godoc
+// @Summary Delete all subscriptions of a user
+// @Tags subscriptions
+// @Produce json
+// @Param user_id query string true "User ID (UUID)"
+// @Success 200 {object} map[string]int "Returns number of deleted subscriptions as JSON {\"deleted\":3}"
+// @Failure 400 {string} string "Invalid user_id parameter is required"
+// @Failure 403 {string} string "Not allowed"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /subscriptions [delete]
+func (s *SubscriptionHandler) PurgeSubscriptions(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := s.authorize(w, r, policy.ActionPurge)
+	if !ok {
+		return
+	}
+
+	userIDStr := r.URL.Query().Get("user_id")
+	if userIDStr == "" {
+		http.Error(w, "Invalid user_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	if callerID != "" && userIDStr != callerID {
+		http.Error(w, "Cannot purge subscriptions of another user", http.StatusForbidden)
+		return
+	}
+
+	ctx := logger.WithFields(r.Context(), log.Fields{"user_id": userIDStr})
+	deleted, err := s.repo.DeleteByUser(ctx, userIDStr)
+	if err != nil {
+		http.Error(w, "Error deleting entries", http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(ctx).Infof("Purged %d subscriptions", deleted)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+}
+
+// maxScheduleMonths limits the window of the upcoming charges endpoint and
+// how far into the future totals reach.
+const maxScheduleMonths = 60
+
+// windowError returns why a total over from..to is refused, or "". Capping
+// to bounds the number of charges summed per subscription.
+func windowError(from, to, today time.Time) string {
+	if !from.IsZero() && to.Before(from) {
+		return "'to' must not be before 'from'"
+	}
+	if to.After(billing.AddMonths(today, maxScheduleMonths)) {
+		return "'to' must be at most 5 years from today"
+	}
+	return ""
+}
+
+// maxBodyBytes caps the size of JSON request bodies. Subscriptions are a
+// few hundred bytes, anything much larger is a mistake or an attack.
+const maxBodyBytes = 64 << 10
+
+// decodeJSON reads a size-limited JSON body into v. On failure it writes a
+// 413 or 400 response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		if errors.Is(err, model.ErrInvalidDate) || errors.Is(err, model.ErrInvalidMoney) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// authorize consults the policy for action. It returns the user the caller
+// is limited to, or "" when the caller may act on every user's
+// subscriptions. When the action is not allowed at all it writes a 403
+// response and returns false. Requests without a principal are not
+// restricted; route middleware decides whether they may get here.
+func (s *SubscriptionHandler) authorize(w http.ResponseWriter, r *http.Request, action policy.Action) (string, bool) {
+	return checkPolicy(w, r, s.policy, action, "subscriptions")
+}
+
+// checkPolicy is authorize for any resource governed by the subscription
+// policy; resource names it in the error message.
+func checkPolicy(w http.ResponseWriter, r *http.Request, pol *policy.Policy, action policy.Action, resource string) (string, bool) {
+	p := auth.FromContext(r.Context())
+	if p == nil {
+		return "", true
+	}
+
+	allowed, all := pol.Check(p.Roles, action)
+	if !allowed {
+		http.Error(w, "Not allowed to "+string(action)+" "+resource, http.StatusForbidden)
+		return "", false
+	}
+	if all {
+		return "", true
+	}
+	// Service keys have no user of their own, "own" rules apply to every user.
+	return p.UserID, true
+}
+
+// checkDuplicates looks for active subscriptions of the same user that sub
+// would duplicate. They are reported in a Warning header, or with a 409
+// response in strict mode, in which case it returns false.
+func (s *SubscriptionHandler) checkDuplicates(w http.ResponseWriter, r *http.Request, sub *model.Subscription) bool {
+	existing, err := s.repo.ListByUser(r.Context(), sub.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	conflicts := dedup.Conflicts(sub, existing)
+	if len(conflicts) == 0 {
+		return true
+	}
+
+	ids := make([]string, len(conflicts))
+	for i, other := range conflicts {
+		ids[i] = other.ID
+	}
+	if s.strictDuplicates {
+		http.Error(w, "Subscription duplicates active subscription "+strings.Join(ids, ", "), http.StatusConflict)
+		return false
 	}
-	return time.Parse("2006-01-02", date)
+	logger.FromContext(r.Context()).Warnf("Subscription duplicates active subscription %s", strings.Join(ids, ", "))
+	for _, id := range ids {
+		w.Header().Add("Warning", `299 - "duplicates subscription `+id+`"`)
+	}
+	return true
+}
+
+// checkBudgets raises the alerts of the budgets sub counts towards. The
+// change is already saved, so a failure is only logged.
+func (s *SubscriptionHandler) checkBudgets(ctx context.Context, sub *model.Subscription) {
+	if s.alerts == nil {
+		return
+	}
+	if err := s.alerts.Check(ctx, sub); err != nil {
+		logger.FromContext(ctx).Errorf("Failed to check budgets: %v", err)
+	}
+}
+
+// applyPlan fills the service of sub from its plan, and the price and
+// billing period when they are not set. On failure it writes the error
+// response and returns false.
+func (s *SubscriptionHandler) applyPlan(w http.ResponseWriter, r *http.Request, sub *model.Subscription) bool {
+	if sub.PlanID == "" {
+		return true
+	}
+	if _, err := uuid.Parse(sub.PlanID); err != nil {
+		http.Error(w, "Invalid plan_id", http.StatusBadRequest)
+		return false
+	}
+
+	plan, err := s.plans.GetByID(r.Context(), sub.PlanID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if plan == nil {
+		http.Error(w, "Unknown plan_id", http.StatusBadRequest)
+		return false
+	}
+	if sub.ServiceID != "" && sub.ServiceID != plan.ServiceID {
+		http.Error(w, "plan_id belongs to a different service", http.StatusBadRequest)
+		return false
+	}
+
+	sub.ServiceID = plan.ServiceID
+	if sub.Price.IsZero() {
+		sub.Price = plan.Price
+	}
+	if sub.BillingPeriod == "" {
+		sub.BillingPeriod = plan.BillingPeriod
+	}
+	return true
+}
+
+// resolveService links sub to the service catalog. An explicit service_id
+// must exist and sets the canonical name; otherwise service_name is looked
+// up by name and alias. Names missing from the catalog are kept as given.
+// On failure it writes the error response and returns false.
+func (s *SubscriptionHandler) resolveService(w http.ResponseWriter, r *http.Request, sub *model.Subscription) bool {
+	var svc *model.Service
+	var err error
+	switch {
+	case sub.ServiceID != "":
+		if _, perr := uuid.Parse(sub.ServiceID); perr != nil {
+			http.Error(w, "Invalid service_id", http.StatusBadRequest)
+			return false
+		}
+		svc, err = s.services.GetByID(r.Context(), sub.ServiceID)
+		if err == nil && svc == nil {
+			http.Error(w, "Unknown service_id", http.StatusBadRequest)
+			return false
+		}
+	case sub.ServiceName != "":
+		svc, err = s.services.Resolve(r.Context(), sub.ServiceName)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if svc != nil {
+		sub.ServiceID = svc.ID
+		sub.ServiceName = svc.Name
+		if sub.Category == "" {
+			sub.Category = svc.Category
+		}
+	}
+	return true
+}
+
+// filterLabels keeps the subscriptions of subs that carry tag and are in
+// category. Empty filters match every subscription.
+func filterLabels(subs []*model.Subscription, tag, category string) []*model.Subscription {
+	tag, category = repository.NormalizeLabel(tag), repository.NormalizeLabel(category)
+	if tag == "" && category == "" {
+		return subs
+	}
+	out := []*model.Subscription{}
+	for _, sub := range subs {
+		if category != "" && repository.NormalizeLabel(sub.Category) != category {
+			continue
+		}
+		if tag != "" && !slices.Contains(sub.Tags, tag) {
+			continue
+		}
+		out = append(out, sub)
+	}
+	return out
+}
+
+// groupLabels returns the labels sub is grouped under for groupBy "tag" or
+// "category". Subscriptions without one are grouped under "".
+func groupLabels(sub *model.Subscription, groupBy string) []string {
+	if groupBy == "tag" {
+		if len(sub.Tags) == 0 {
+			return []string{""}
+		}
+		return sub.Tags
+	}
+	return []string{sub.Category}
+}
+
+// setNextCharge fills the computed next charge date of subs from today.
+func setNextCharge(ctx context.Context, subs ...*model.Subscription) {
+	day := today(ctx)
+	for _, sub := range subs {
+		if c, ok := billing.NextCharge(sub, day); ok {
+			sub.NextChargeDate = model.DateOf(c.Date)
+		}
+	}
+}
+
+// ownedBy reports whether sub is visible to a caller limited to callerID.
+func ownedBy(sub *model.Subscription, callerID string) bool {
+	return callerID == "" || sub.UserID == callerID
+}
+
+// Limits on the labels of a subscription.
+const (
+	maxTags        = 20
+	maxLabelLength = 50
+)
+
+// validateLabels checks the category and tags of sub and returns an error
+// message, or "" when they are acceptable.
+func validateLabels(sub *model.Subscription) string {
+	if len(sub.Tags) > maxTags {
+		return "At most " + strconv.Itoa(maxTags) + " tags are allowed"
+	}
+	if len(sub.Category) > maxLabelLength {
+		return "category must be at most " + strconv.Itoa(maxLabelLength) + " characters"
+	}
+	for _, t := range sub.Tags {
+		if len(t) > maxLabelLength {
+			return "Tags must be at most " + strconv.Itoa(maxLabelLength) + " characters"
+		}
+	}
+	return ""
+}
+
+// maxMembers limits the number of members sharing a subscription.
+const maxMembers = 20
+
+// validateMembers checks the members of sub, gives members without a fixed
+// amount weight 1 by default and returns an error message, or "" when
+// they are consistent.
+func validateMembers(sub *model.Subscription) string {
+	if len(sub.Members) > maxMembers {
+		return "At most " + strconv.Itoa(maxMembers) + " members are allowed"
+	}
+	seen := map[string]bool{}
+	for i := range sub.Members {
+		m := &sub.Members[i]
+		if _, err := uuid.Parse(m.UserID); err != nil {
+			return "Invalid member user_id"
+		}
+		if seen[m.UserID] {
+			return "Duplicate member " + m.UserID
+		}
+		seen[m.UserID] = true
+		switch {
+		case m.Weight < 0 || (m.Amount != nil && m.Amount.Amount < 0):
+			return "Member weight and amount must not be negative"
+		case m.Amount != nil && m.Weight != 0:
+			return "A member has either weight or amount, not both"
+		case m.Amount == nil && m.Weight == 0:
+			m.Weight = 1
+		}
+	}
+	return ""
+}
+
+// resolveCurrency puts the amounts of sub into currency, or into the
+// currency of its user when currency is empty. Amounts given without a
+// currency are taken to be in it, those given in another one are rejected.
+// On failure it writes the error response and returns false.
+func (s *SubscriptionHandler) resolveCurrency(w http.ResponseWriter, r *http.Request, sub *model.Subscription, currency string) bool {
+	if currency == "" {
+		var err error
+		if currency, err = s.userCurrency(r.Context(), sub.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+	}
+	if !validCurrency(currency) {
+		http.Error(w, "Invalid currency, use an ISO 4217 code such as RUB", http.StatusBadRequest)
+		return false
+	}
+
+	var err error
+	if sub.Price, err = sub.Price.In(currency); err != nil {
+		http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if sub.IntroPrice != nil {
+		if *sub.IntroPrice, err = sub.IntroPrice.In(currency); err != nil {
+			http.Error(w, "intro_price must be in the currency of price", http.StatusBadRequest)
+			return false
+		}
+	}
+	for i := range sub.Members {
+		if m := &sub.Members[i]; m.Amount != nil {
+			if *m.Amount, err = m.Amount.In(currency); err != nil {
+				http.Error(w, "Member amounts must be in the currency of price", http.StatusBadRequest)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// currencyConflict returns why sub cannot move from its stored currency
+// to currency, or "" when it can. Amounts are never converted: the intro
+// price and member amounts have to be given again, and price changes,
+// applied ones included since they keep the old price for earlier charges,
+// stay in the currency they were made in.
+func currencyConflict(sub *model.Subscription, stored, currency string) string {
+	if stored == "" || strings.EqualFold(stored, currency) {
+		return ""
+	}
+	if len(sub.PriceChanges) > 0 {
+		return "Cannot change the currency of a subscription with price changes in " + stored
+	}
+	if sub.IntroPrice != nil && sub.IntroPrice.Currency == stored {
+		return "Cannot change the currency while intro_price is in " + stored + ", give it again"
+	}
+	for _, m := range sub.Members {
+		if m.Amount != nil && m.Amount.Currency == stored {
+			return "Cannot change the currency while member amounts are in " + stored + ", give them again"
+		}
+	}
+	return ""
+}
+
+// userCurrency returns the currency of userID, DefaultCurrency for no or
+// an unknown user.
+func (s *SubscriptionHandler) userCurrency(ctx context.Context, userID string) (string, error) {
+	if userID == "" {
+		return model.DefaultCurrency, nil
+	}
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil || u == nil {
+		return model.DefaultCurrency, err
+	}
+	return u.Currency, nil
+}
+
+// fillCurrency gives amounts summed over no subscriptions, which have no
+// currency of their own, the currency of userID, or DefaultCurrency without
+// a user. On failure it writes the error response and returns false.
+func (s *SubscriptionHandler) fillCurrency(w http.ResponseWriter, r *http.Request, userID *string, amounts ...*model.Money) bool {
+	var empty []*model.Money
+	for _, m := range amounts {
+		if m.Currency == "" {
+			empty = append(empty, m)
+		}
+	}
+	if len(empty) == 0 {
+		return true
+	}
+	var id string
+	if userID != nil {
+		id = *userID
+	}
+	currency, err := s.userCurrency(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	for _, m := range empty {
+		m.Currency = currency
+	}
+	return true
+}
+
+// writeSumError writes the response for a failed total: 422 when the
+// subscriptions are in different currencies.
+func writeSumError(w http.ResponseWriter, err error) {
+	if errors.Is(err, model.ErrMixedCurrencies) {
+		http.Error(w, "Cannot add up subscriptions in different currencies", http.StatusUnprocessableEntity)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// validateDates resolves the month-granular dates of sub to days, the
+// first day of the month for start_date and the last one for end_date and
+// trial_end_date, and returns an error message, or "" when they are valid.
+func validateDates(sub *model.Subscription) string {
+	start, err := sub.StartDate.First()
+	if err != nil {
+		return "Invalid start_date"
+	}
+	sub.StartDate = model.DateOf(start)
+	if sub.EndDate != "" {
+		end, err := sub.EndDate.Last()
+		if err != nil {
+			return "Invalid end_date"
+		}
+		if end.Before(start) {
+			return "end_date must not be before start_date"
+		}
+		sub.EndDate = model.DateOf(end)
+	}
+	if sub.TrialEndDate != "" {
+		trialEnd, err := sub.TrialEndDate.Last()
+		if err != nil {
+			return "Invalid trial_end_date"
+		}
+		sub.TrialEndDate = model.DateOf(trialEnd)
+	}
+	return ""
+}
+
+// validateTrial checks the trial and intro pricing fields of sub and returns
+// an error message, or "" when they are consistent.
+func validateTrial(sub *model.Subscription) string {
+	if sub.TrialEndDate != "" && sub.TrialEndDate < sub.StartDate {
+		return "trial_end_date must not be before start_date"
+	}
+	if sub.IntroMonths < 0 || (sub.IntroPrice != nil && sub.IntroPrice.Amount < 0) {
+		return "intro_price and intro_months must not be negative"
+	}
+	if (sub.IntroPrice != nil) != (sub.IntroMonths > 0) {
+		return "intro_price and intro_months must be set together"
+	}
+	return ""
+}
+
+// parseWithin parses a look-ahead window given in days, such as "7d", or
+// as a Go duration, such as "48h".
+func parseWithin(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// today returns the current date in the zone of the request at midnight
+// UTC, the form dates are parsed into.
+func today(ctx context.Context) time.Time {
+	return zone.TodayIn(ctx)
+}
+
+// parseDate parses a date starting a period, the first day of a month.
+func parseDate(date string) (time.Time, error) {
+	return model.Date(date).First()
+}
+
+// parseEndDate parses a date ending a period, the last day of a month.
+func parseEndDate(date string) (time.Time, error) {
+	return model.Date(date).Last()
 }
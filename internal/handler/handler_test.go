@@ -3,43 +3,73 @@ package handler
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/budget"
 	"github.com/Elmar006/subscription_service/internal/config"
 	"github.com/Elmar006/subscription_service/internal/db"
 	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/policy"
 	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/zone"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
+func connectTestDB() *sql.DB {
+	cfg := config.Default()
+	cfg.DBHost = "localhost"
+	cfg.DBPort = "5432"
+	cfg.DBUser = "postgres"
+	cfg.DBPass = "postgres"
+	cfg.DBName = "subscription_test"
+	return db.Connect(cfg)
+}
+
+func createTestUser(t *testing.T, database *sql.DB) string {
+	u := &model.User{Name: "Test User", Timezone: "UTC", Currency: "RUB", CreatedAt: time.Now()}
+	if err := repository.NewUserRepo(database).Create(context.Background(), u); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return u.ID
+}
+
+// rub returns amount kopecks in roubles.
+func rub(amount int64) model.Money {
+	return model.Money{Amount: amount, Currency: "RUB"}
+}
+
 func setupHandler(t *testing.T) (*SubscriptionHandler, *model.Subscription, repository.SubscriptionRepository) {
-	cfg := &config.Config{
-		DBHost: "localhost",
-		DBPort: "5432",
-		DBUser: "postgres",
-		DBPass: "postgres",
-		DBName: "subscription_test",
-	}
-	database := db.Connect(cfg)
+	database := connectTestDB()
 	repo := repository.NewSubscriptionRepo(database)
-	h := NewSubscriptionHandler(repo)
+	pol, err := policy.New(policy.Default())
+	if err != nil {
+		t.Fatalf("Failed to build policy: %v", err)
+	}
+	users := repository.NewUserRepo(database)
+	zones := zone.NewResolver(users, repository.NewOrganizationRepo(database))
+	alerts := budget.NewAlerts(repository.NewBudgetRepo(database), repository.NewWebhookRepo(database), zones)
+	h := NewSubscriptionHandler(repo, repository.NewServiceRepo(database), repository.NewPlanRepo(database), users, alerts, pol, false)
 
-	userID := uuid.New().String()
+	userID := createTestUser(t, database)
 
 	sub := &model.Subscription{
 		ServiceName: "Test Service",
-		Price:       888,
+		Price:       rub(888),
 		UserID:      userID,
 		StartDate:   "2026-01-01",
 		EndDate:     "2026-01-31",
 		CreatedAt:   time.Now(),
 	}
-	if err := repo.Create(sub); err != nil {
+	if err := repo.Create(context.Background(), sub); err != nil {
 		t.Fatalf("Failed to create subscription: %v", err)
 	}
 
@@ -52,7 +82,7 @@ func TestCreateSub(t *testing.T) {
 	body := map[string]interface{}{
 		"service_name": "Music Plus",
 		"price":        500,
-		"user_id":      uuid.New().String(),
+		"user_id":      createTestUser(t, connectTestDB()),
 		"start_date":   "2026-02-01",
 	}
 
@@ -70,7 +100,7 @@ func TestCreateSub(t *testing.T) {
 	if err := json.NewDecoder(w.Body).Decode(&sub); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
-	if sub.ServiceName != "Music Plus" || sub.Price != 500 {
+	if sub.ServiceName != "Music Plus" || sub.Price != rub(50000) {
 		t.Errorf("Response mismatch, got %v", sub)
 	}
 	if sub.ID == "" {
@@ -78,6 +108,233 @@ func TestCreateSub(t *testing.T) {
 	}
 }
 
+func TestCreateSubMonthDates(t *testing.T) {
+	h, _, _ := setupHandler(t)
+
+	body := map[string]interface{}{
+		"service_name": "Month Service",
+		"price":        300,
+		"user_id":      createTestUser(t, connectTestDB()),
+		"start_date":   "07-2025",
+		"end_date":     "2025-09",
+	}
+
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+
+	h.CreateSubscription(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var sub model.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&sub); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if sub.StartDate != "2025-07-01" || sub.EndDate != "2025-09-30" {
+		t.Errorf("Expected 2025-07-01 to 2025-09-30, got %s to %s", sub.StartDate, sub.EndDate)
+	}
+
+	body["start_date"] = "13-2025"
+	data, _ = json.Marshal(body)
+	req = httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(data))
+	w = httptest.NewRecorder()
+
+	h.CreateSubscription(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request for an invalid date, got %d", w.Code)
+	}
+}
+
+func TestCreateSubCurrency(t *testing.T) {
+	h, _, _ := setupHandler(t)
+
+	u := &model.User{Name: "Euro User", Timezone: "UTC", Currency: "EUR", CreatedAt: time.Now()}
+	if err := h.users.Create(context.Background(), u); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	create := func(price interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(map[string]interface{}{
+			"service_name": "Currency Service",
+			"price":        price,
+			"user_id":      u.ID,
+			"start_date":   "2026-01-01",
+		})
+		w := httptest.NewRecorder()
+		h.CreateSubscription(w, httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(data)))
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	h.GetSubscriptionTotal(w, httptest.NewRequest(http.MethodGet, "/subscriptions/total?user_id="+u.ID, nil))
+	var empty model.Total
+	if err := json.NewDecoder(w.Body).Decode(&empty); err != nil || empty.Total != (model.Money{Currency: "EUR"}) {
+		t.Errorf("Expected an empty total in the user's currency, got %+v, %v", empty.Total, err)
+	}
+
+	w = create("9.99")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+	var sub model.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&sub); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if sub.Price != (model.Money{Amount: 999, Currency: "EUR"}) {
+		t.Errorf("Expected the price in the user's currency, got %+v", sub.Price)
+	}
+
+	if w := create("9.999"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request for too many decimals, got %d", w.Code)
+	}
+	if w := create(map[string]string{"amount": "399.99", "currency": "RUB"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/total?user_id="+u.ID+"&from=2026-01-01&to=2026-01-31", nil)
+	w = httptest.NewRecorder()
+	h.GetSubscriptionTotal(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a total over two currencies, got %d", w.Code)
+	}
+}
+
+func TestCreateSubFromPlan(t *testing.T) {
+	h, _, _ := setupHandler(t)
+
+	svc := &model.Service{Name: "Plan Service " + uuid.New().String(), CreatedAt: time.Now()}
+	if err := h.services.Create(context.Background(), svc); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	plan := &model.Plan{ServiceID: svc.ID, Name: "Premium", Price: rub(1299), BillingPeriod: model.BillingYearly, CreatedAt: time.Now()}
+	if err := h.plans.Create(context.Background(), plan); err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	body := map[string]interface{}{
+		"plan_id":    plan.ID,
+		"user_id":    createTestUser(t, connectTestDB()),
+		"start_date": "2026-02-01",
+	}
+
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+
+	h.CreateSubscription(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d", w.Code)
+	}
+
+	var sub model.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&sub); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if sub.ServiceName != svc.Name || sub.ServiceID != svc.ID || sub.Price != rub(1299) || sub.BillingPeriod != model.BillingYearly {
+		t.Errorf("Subscription not filled from plan, got %+v", sub)
+	}
+}
+
+func TestUpdateSubPlan(t *testing.T) {
+	h, _, repo := setupHandler(t)
+
+	svc := &model.Service{Name: "Switch Service " + uuid.New().String(), CreatedAt: time.Now()}
+	if err := h.services.Create(context.Background(), svc); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	basic := &model.Plan{ServiceID: svc.ID, Name: "Basic", Price: rub(29900), BillingPeriod: model.BillingMonthly, CreatedAt: time.Now()}
+	premium := &model.Plan{ServiceID: svc.ID, Name: "Premium", Price: rub(299900), BillingPeriod: model.BillingYearly, CreatedAt: time.Now()}
+	for _, plan := range []*model.Plan{basic, premium} {
+		if err := h.plans.Create(context.Background(), plan); err != nil {
+			t.Fatalf("Failed to create plan: %v", err)
+		}
+	}
+	intro := rub(100)
+	sub := &model.Subscription{
+		ServiceName: svc.Name, ServiceID: svc.ID, PlanID: basic.ID, Price: basic.Price, IntroPrice: &intro, IntroMonths: 1,
+		UserID: createTestUser(t, connectTestDB()), StartDate: "2026-01-01", CreatedAt: time.Now(),
+	}
+	if err := repo.Create(context.Background(), sub); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"plan_id": premium.ID})
+	req := httptest.NewRequest(http.MethodPut, "/subscriptions/"+sub.ID, bytes.NewReader(data))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", sub.ID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	h.UpdateByIDSubscription(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var updated model.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&updated); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if updated.PlanID != premium.ID || updated.Price != premium.Price || updated.BillingPeriod != model.BillingYearly ||
+		updated.IntroPrice != nil || updated.IntroMonths != 0 {
+		t.Errorf("Expected the premium plan's terms, got %+v", updated)
+	}
+}
+
+func TestCreateSubDuplicate(t *testing.T) {
+	h, _, _ := setupHandler(t)
+
+	userID := createTestUser(t, connectTestDB())
+	create := func(h *SubscriptionHandler) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(map[string]interface{}{
+			"service_name": "Duplicate Tool",
+			"price":        700,
+			"user_id":      userID,
+			"start_date":   "2026-02-01",
+		})
+		w := httptest.NewRecorder()
+		h.CreateSubscription(w, httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(data)))
+		return w
+	}
+
+	if w := create(h); w.Code != http.StatusCreated || w.Header().Get("Warning") != "" {
+		t.Fatalf("Expected the first subscription to be created without warning, got %d %v", w.Code, w.Header())
+	}
+	w := create(h)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Header().Get("Warning"), "duplicates subscription") {
+		t.Errorf("Expected a duplicate warning, got %d %v", w.Code, w.Header())
+	}
+
+	strict := *h
+	strict.strictDuplicates = true
+	if w := create(&strict); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 Conflict in strict mode, got %d", w.Code)
+	}
+}
+
+func TestCreateSubBodyTooLarge(t *testing.T) {
+	h, _, _ := setupHandler(t)
+
+	body := map[string]interface{}{
+		"service_name": strings.Repeat("x", maxBodyBytes),
+		"price":        500,
+		"user_id":      uuid.New().String(),
+		"start_date":   "2026-02-01",
+	}
+
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+
+	h.CreateSubscription(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 Request Entity Too Large, got %d", w.Code)
+	}
+}
+
 func TestGetByIDSub(t *testing.T) {
 	h, sub, _ := setupHandler(t)
 
@@ -103,6 +360,42 @@ func TestGetByIDSub(t *testing.T) {
 	}
 }
 
+func TestGetByIDSubOtherUser(t *testing.T) {
+	h, sub, _ := setupHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/"+sub.ID, nil)
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", sub.ID)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = auth.NewContext(ctx, &auth.Principal{UserID: uuid.New().String(), Roles: []string{"editor"}, Scopes: []string{auth.ScopeWrite}})
+	req = req.WithContext(ctx)
+
+	h.GetByIDSubscription(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 Not Found for another user's subscription, got %d", w.Code)
+	}
+}
+
+func TestDeleteSubscriptionForbiddenForEditor(t *testing.T) {
+	h, sub, _ := setupHandler(t)
+
+	req := httptest.NewRequest(http.MethodDelete, "/subscriptions/"+sub.ID, nil)
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", sub.ID)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = auth.NewContext(ctx, &auth.Principal{UserID: sub.UserID, Roles: []string{"editor"}, Scopes: []string{auth.ScopeWrite}})
+	req = req.WithContext(ctx)
+
+	h.DeleteSubscription(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 Forbidden for editor, got %d", w.Code)
+	}
+}
+
 func TestListByUser(t *testing.T) {
 	h, sub, _ := setupHandler(t)
 
@@ -152,11 +445,72 @@ func TestUpdateSubscription(t *testing.T) {
 		t.Fatalf("Decode error: %v", err)
 	}
 
-	if updated.ServiceName != "Updated Service" || updated.Price != 999 {
+	if updated.ServiceName != "Updated Service" || updated.Price != rub(99900) {
 		t.Errorf("Update failed, got %+v", updated)
 	}
 }
 
+func TestUpdateSubscriptionCurrency(t *testing.T) {
+	h, _, repo := setupHandler(t)
+
+	svc := &model.Service{Name: "Currency Plan Service " + uuid.New().String(), CreatedAt: time.Now()}
+	if err := h.services.Create(context.Background(), svc); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	plan := &model.Plan{ServiceID: svc.ID, Name: "Basic", Price: rub(50000), BillingPeriod: model.BillingMonthly, CreatedAt: time.Now()}
+	if err := h.plans.Create(context.Background(), plan); err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	intro := rub(10000)
+	sub := &model.Subscription{
+		ServiceName: "Intro Service", Price: rub(50000), IntroPrice: &intro, IntroMonths: 2,
+		UserID: createTestUser(t, connectTestDB()), StartDate: "2026-01-01", CreatedAt: time.Now(),
+	}
+	if err := repo.Create(context.Background(), sub); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	update := func(id string, body map[string]interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPut, "/subscriptions/"+id, bytes.NewReader(data))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		h.UpdateByIDSubscription(w, req)
+		return w
+	}
+	eur := map[string]string{"amount": "9.99", "currency": "EUR"}
+
+	if w := update(sub.ID, map[string]interface{}{"price": eur}); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 Conflict with the intro price in RUB, got %d: %s", w.Code, w.Body.String())
+	}
+	w := update(sub.ID, map[string]interface{}{"price": eur, "intro_price": "1.00"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK with the intro price given again, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated model.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&updated); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if updated.Price != (model.Money{Amount: 999, Currency: "EUR"}) || *updated.IntroPrice != (model.Money{Amount: 100, Currency: "EUR"}) {
+		t.Errorf("Expected the amounts in EUR, got %+v and %+v", updated.Price, updated.IntroPrice)
+	}
+
+	onPlan := &model.Subscription{
+		ServiceName: svc.Name, ServiceID: svc.ID, PlanID: plan.ID, Price: rub(50000),
+		UserID: sub.UserID, StartDate: "2026-01-01", CreatedAt: time.Now(),
+	}
+	if err := repo.Create(context.Background(), onPlan); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	if _, err := h.plans.Reprice(context.Background(), plan.ID, rub(65000), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Reprice failed: %v", err)
+	}
+	if w := update(onPlan.ID, map[string]interface{}{"price": eur}); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 Conflict with a pending price change, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 func TestDeleteSubscription(t *testing.T) {
 	h, sub, _ := setupHandler(t)
 
@@ -189,13 +543,13 @@ func TestGetSubscriptionTotal(t *testing.T) {
 
 	sub2 := &model.Subscription{
 		ServiceName: "Test Service",
-		Price:       200,
+		Price:       rub(200),
 		UserID:      sub.UserID,
 		StartDate:   "2026-01-15",
 		EndDate:     "2026-02-15",
 		CreatedAt:   time.Now(),
 	}
-	repo.Create(sub2)
+	repo.Create(context.Background(), sub2)
 
 	req := httptest.NewRequest(http.MethodGet, "/subscriptions/total?user_id="+sub.UserID+"&from=2026-01-01&to=2026-01-31", nil)
 	w := httptest.NewRecorder()
@@ -206,13 +560,298 @@ func TestGetSubscriptionTotal(t *testing.T) {
 		t.Fatalf("Expected 200 OK, got %d", w.Code)
 	}
 
-	var resp map[string]int
+	var resp model.Total
 	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
 		t.Fatalf("Decode error: %v", err)
 	}
 
-	expected := sub.Price + sub2.Price
-	if resp["total"] != expected {
-		t.Errorf("Expected total %d, got %d", expected, resp["total"])
+	expected := sub.Price.Add(sub2.Price)
+	if resp.Total != expected {
+		t.Errorf("Expected total %s, got %s", expected, resp.Total)
+	}
+}
+
+func TestSubscriptionTags(t *testing.T) {
+	h, sub, repo := setupHandler(t)
+
+	tagged := &model.Subscription{
+		ServiceName: "Tagged Service",
+		Price:       rub(300),
+		UserID:      sub.UserID,
+		StartDate:   "2026-01-01",
+		Category:    " Dev  Tools",
+		Tags:        []string{"Work", "team", "work"},
+		CreatedAt:   time.Now(),
+	}
+	if err := repo.Create(context.Background(), tagged); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions?user_id="+sub.UserID+"&tag=work&category=dev+tools", nil)
+	w := httptest.NewRecorder()
+	h.GetSubscription(w, req)
+
+	var list []model.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != tagged.ID {
+		t.Fatalf("Expected only the tagged subscription, got %+v", list)
+	}
+	if list[0].Category != "dev tools" || !reflect.DeepEqual(list[0].Tags, []string{"team", "work"}) {
+		t.Errorf("Expected normalised labels, got %q %v", list[0].Category, list[0].Tags)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/subscriptions/total?user_id="+sub.UserID+"&from=2026-01-01&to=2026-01-31&group_by=tag", nil)
+	w = httptest.NewRecorder()
+	h.GetSubscriptionTotal(w, req)
+
+	var total model.Total
+	if err := json.NewDecoder(w.Body).Decode(&total); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	want := []model.GroupTotal{{Name: "", Total: sub.Price}, {Name: "team", Total: rub(300)}, {Name: "work", Total: rub(300)}}
+	if total.Total != sub.Price.Add(rub(300)) || !reflect.DeepEqual(total.Groups, want) {
+		t.Errorf("Expected total %s with groups %v, got %+v", sub.Price.Add(rub(300)), want, total)
+	}
+}
+
+func TestGetUserBalances(t *testing.T) {
+	h, sub, repo := setupHandler(t)
+	member := createTestUser(t, connectTestDB())
+
+	shared := &model.Subscription{
+		ServiceName: "Family Plan",
+		Price:       rub(900),
+		UserID:      sub.UserID,
+		StartDate:   "2026-01-01",
+		Members:     []model.Member{{UserID: member, Weight: 2}},
+		CreatedAt:   time.Now(),
+	}
+	if err := repo.Create(context.Background(), shared); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/users/"+member+"/balances?from=2026-01-01&to=2026-01-31", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", member)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	h.GetUserBalances(w, req)
+
+	var b model.Balances
+	if err := json.NewDecoder(w.Body).Decode(&b); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	want := []model.Debt{{From: member, To: sub.UserID, Amount: rub(600)}}
+	if b.Owes != rub(600) || !reflect.DeepEqual(b.Debts, want) {
+		t.Errorf("Expected the member to owe 600, got %+v", b)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/subscriptions/total?user_id="+member+"&from=2026-01-01&to=2026-01-31", nil)
+	w = httptest.NewRecorder()
+	h.GetSubscriptionTotal(w, req)
+
+	var total model.Total
+	if err := json.NewDecoder(w.Body).Decode(&total); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if total.Total != rub(600) {
+		t.Errorf("Expected the member's total to be their share 6.00, got %s", total.Total)
+	}
+}
+
+func TestGetUpcomingCharges(t *testing.T) {
+	h, _, repo := setupHandler(t)
+
+	userID := createTestUser(t, connectTestDB())
+	sub := &model.Subscription{
+		ServiceName:   "Upcoming Service",
+		Price:         rub(300),
+		BillingPeriod: model.BillingMonthly,
+		UserID:        userID,
+		StartDate:     "2026-01-10",
+		EndDate:       "2026-03-31",
+		CreatedAt:     time.Now(),
+	}
+	if err := repo.Create(context.Background(), sub); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/upcoming?user_id="+userID+"&from=2026-02-01&to=2026-06-30", nil)
+	w := httptest.NewRecorder()
+
+	h.GetUpcomingCharges(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+
+	var events []model.ChargeEvent
+	if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if len(events) != 2 || events[0].Date != "2026-02-10" || events[1].Date != "2026-03-10" || events[0].Amount != rub(300) {
+		t.Errorf("Unexpected charges %+v", events)
+	}
+}
+
+func TestGetSubscriptionForecast(t *testing.T) {
+	h, _, repo := setupHandler(t)
+
+	userID := createTestUser(t, connectTestDB())
+	first := time.Date(time.Now().Year(), time.Now().Month(), 1, 0, 0, 0, 0, time.UTC)
+	sub := &model.Subscription{
+		ServiceName:   "Forecast Service",
+		Price:         rub(100),
+		BillingPeriod: model.BillingMonthly,
+		UserID:        userID,
+		StartDate:     model.DateOf(first),
+		EndDate:       model.DateOf(first.AddDate(0, 2, -1)),
+		CreatedAt:     time.Now(),
+	}
+	if err := repo.Create(context.Background(), sub); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/forecast?user_id="+userID+"&months=4&group_by=user", nil)
+	w := httptest.NewRecorder()
+
+	h.GetSubscriptionForecast(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+
+	var forecast model.Forecast
+	if err := json.NewDecoder(w.Body).Decode(&forecast); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if len(forecast.Months) != 4 || forecast.Months[0].Month != first.Format("2006-01") || forecast.Total != rub(200) {
+		t.Errorf("Unexpected forecast %+v", forecast)
+	}
+	if forecast.Months[1].Amount != rub(100) || forecast.Months[2].Amount != rub(0) {
+		t.Errorf("Expected charges in the first two months only, got %+v", forecast.Months)
+	}
+	if len(forecast.Users) != 1 || forecast.Users[0].UserID != userID || forecast.Users[0].Total != rub(200) {
+		t.Errorf("Unexpected per-user forecast %+v", forecast.Users)
+	}
+}
+
+func TestBudgetStatusAndAlert(t *testing.T) {
+	h, _, _ := setupHandler(t)
+	database := connectTestDB()
+	budgets := repository.NewBudgetRepo(database)
+	bh := NewBudgetHandler(budgets, h.users, zone.NewResolver(h.users, repository.NewOrganizationRepo(database)), h.policy)
+
+	userID := createTestUser(t, connectTestDB())
+	data, _ := json.Marshal(map[string]interface{}{"user_id": userID, "amount": 1000})
+	w := httptest.NewRecorder()
+	bh.CreateBudget(w, httptest.NewRequest(http.MethodPost, "/budgets", bytes.NewReader(data)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+	var b model.Budget
+	json.NewDecoder(w.Body).Decode(&b)
+
+	month := time.Now().Format("2006-01")
+	data, _ = json.Marshal(map[string]interface{}{
+		"service_name": "Budget Service",
+		"price":        850,
+		"user_id":      userID,
+		"start_date":   month + "-01",
+	})
+	w = httptest.NewRecorder()
+	h.CreateSubscription(w, httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(data)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/budgets/"+b.ID+"/status?month="+month, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", b.ID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w = httptest.NewRecorder()
+	bh.GetBudgetStatus(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+	var st model.BudgetStatus
+	json.NewDecoder(w.Body).Decode(&st)
+	if st.Spent != rub(85000) || st.Utilisation != 85 || st.Threshold != 80 {
+		t.Errorf("Unexpected status %+v", st)
+	}
+
+	// Creating the subscription already wrote the 80% alert.
+	added, err := repository.NewWebhookRepo(database).Enqueue(context.Background(), model.EventBudgetThreshold, "",
+		"budget:"+b.ID+":"+month+":80", nil)
+	if err != nil || added {
+		t.Errorf("Expected the 80%% alert to be written once, got %v, %v", added, err)
+	}
+}
+
+func TestUserSummaryAndDelete(t *testing.T) {
+	h, _, repo := setupHandler(t)
+	uh := NewUserHandler(repository.NewUserRepo(connectTestDB()), repo, h.policy)
+
+	data, _ := json.Marshal(map[string]interface{}{"name": "Anna", "timezone": "Europe/Moscow", "currency": "eur"})
+	w := httptest.NewRecorder()
+	uh.CreateUser(w, httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(data)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+	var u model.User
+	json.NewDecoder(w.Body).Decode(&u)
+	if u.Currency != "EUR" {
+		t.Errorf("Expected currency EUR, got %q", u.Currency)
+	}
+
+	sub := &model.Subscription{ServiceName: "Summary Service", Price: model.Money{Amount: 400, Currency: "EUR"}, UserID: u.ID,
+		StartDate: model.DateOf(time.Now().AddDate(0, -1, 0)), CreatedAt: time.Now()}
+	if err := repo.Create(context.Background(), sub); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	withID := func(req *http.Request) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", u.ID)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	w = httptest.NewRecorder()
+	uh.GetUserSummary(w, withID(httptest.NewRequest(http.MethodGet, "/users/"+u.ID+"/summary", nil)))
+	var summary model.UserSummary
+	json.NewDecoder(w.Body).Decode(&summary)
+	if summary.ActiveCount != 1 || summary.MonthlySpend != (model.Money{Amount: 400, Currency: "EUR"}) || len(summary.NextCharges) != 1 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	w = httptest.NewRecorder()
+	uh.DeleteUser(w, withID(httptest.NewRequest(http.MethodDelete, "/users/"+u.ID, nil)))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 Conflict without cascade or reassign_to, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	uh.DeleteUser(w, withID(httptest.NewRequest(http.MethodDelete, "/users/"+u.ID+"?cascade=true", nil)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 No Content, got %d: %s", w.Code, w.Body.String())
+	}
+	if check, _ := repo.GetByID(context.Background(), sub.ID); check != nil {
+		t.Errorf("Expected the subscription to be deleted with its user")
+	}
+}
+
+func TestRevokeAPIKeyInvalidID(t *testing.T) {
+	h := NewAPIKeyHandler(nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/api-keys/not-a-uuid", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "not-a-uuid")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	h.RevokeAPIKey(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request, got %d", w.Code)
 	}
 }
@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/zone"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+type OrganizationHandler struct {
+	repo repository.OrganizationRepository
+}
+
+func NewOrganizationHandler(repo repository.OrganizationRepository) *OrganizationHandler {
+	return &OrganizationHandler{repo: repo}
+}
+
+// CreateOrganization godoc
+// @Summary Create an organization
+// @Description timezone, an IANA zone name, defaults to UTC
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param organization body model.Organization true "Organization name"
+// @Success 201 {object} model.Organization
+// @Failure 400 {string} string "Invalid request"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orgs [post]
+func (s *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var org model.Organization
+	if !decodeJSON(w, r, &org) {
+		return
+	}
+
+	if org.Name == "" {
+		http.Error(w, "Invalid request, name is required", http.StatusBadRequest)
+		return
+	}
+	if org.Timezone == "" {
+		org.Timezone = defaultTimezone
+	}
+	if _, err := time.LoadLocation(org.Timezone); err != nil {
+		http.Error(w, "Invalid timezone, use an IANA name such as Europe/Moscow", http.StatusBadRequest)
+		return
+	}
+	org.ID = uuid.New().String()
+	org.CreatedAt = time.Now()
+
+	if err := s.repo.Create(r.Context(), &org); err != nil {
+		http.Error(w, "Failed to create organization: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Organization %s created", org.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// ListOrganizations godoc
+// @Summary List organizations
+// @Tags organizations
+// @Produce json
+// @Success 200 {array} model.Organization
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orgs [get]
+func (s *OrganizationHandler) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := s.repo.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgs)
+}
+
+// AddOrgMember godoc
+// @Summary Add a member to an organization
+// @Description Adds a user to the organization or changes their role (member or head)
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param member body model.OrgMember true "User ID and role"
+// @Success 200 {object} model.OrgMember
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Organization not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orgs/{id}/members [post]
+func (s *OrganizationHandler) AddOrgMember(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var member model.OrgMember
+	if !decodeJSON(w, r, &member) {
+		return
+	}
+
+	if member.Role == "" {
+		member.Role = model.OrgRoleMember
+	}
+	if _, err := uuid.Parse(member.UserID); err != nil || (member.Role != model.OrgRoleMember && member.Role != model.OrgRoleHead) {
+		http.Error(w, "Invalid request, user_id must be a UUID and role member or head", http.StatusBadRequest)
+		return
+	}
+	member.OrgID = org.ID
+	member.CreatedAt = time.Now()
+
+	if err := s.repo.AddMember(r.Context(), &member); err != nil {
+		if errors.Is(err, repository.ErrUnknownUser) {
+			http.Error(w, "Unknown user_id", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// RemoveOrgMember godoc
+// @Summary Remove a member from an organization
+// @Tags organizations
+// @Param id path string true "Organization ID"
+// @Param user_id path string true "User ID"
+// @Success 204
+// @Failure 404 {string} string "Member not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orgs/{id}/members/{user_id} [delete]
+func (s *OrganizationHandler) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	found, err := s.repo.RemoveMember(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "user_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListOrgMembers godoc
+// @Summary List organization members
+// @Description Available to admins and to heads of the organization
+// @Tags organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {array} model.OrgMember
+// @Failure 404 {string} string "Organization not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orgs/{id}/members [get]
+func (s *OrganizationHandler) ListOrgMembers(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := s.repo.ListMembers(r.Context(), org.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// GetOrgTotal godoc
+// @Summary Get total price of an organization's subscriptions
+// @Description Returns the organization total with a per-member breakdown. Available to admins and to heads of the organization
+// @Tags organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param service_name query string false "Service name filter"
+// @Param from query string false "Start date filter (YYYY-MM-DD, or a month as YYYY-MM or MM-YYYY meaning its first day)"
+// @Param to query string false "End date filter (YYYY-MM-DD, or a month as YYYY-MM or MM-YYYY meaning its last day), at most 5 years from today"
+// @Success 200 {object} model.OrgTotal
+// @Failure 400 {string} string "Invalid date format"
+// @Failure 404 {string} string "Organization not found"
+// @Failure 422 {string} string "Subscriptions in different currencies"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /orgs/{id}/total [get]
+func (s *OrganizationHandler) GetOrgTotal(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var serviceNamePtr *string
+	if name := q.Get("service_name"); name != "" {
+		serviceNamePtr = &name
+	}
+
+	from := time.Time{}
+	if fromStr := q.Get("from"); fromStr != "" {
+		t, err := parseDate(fromStr)
+		if err != nil {
+			http.Error(w, "Invalid 'from' date", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	day := zone.Today(time.Now(), zone.Load(org.Timezone))
+	to := day
+	if toStr := q.Get("to"); toStr != "" {
+		t, err := parseEndDate(toStr)
+		if err != nil {
+			http.Error(w, "Invalid 'to' date", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if msg := windowError(from, to, day); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	total, err := s.repo.Total(r.Context(), org.ID, serviceNamePtr, from, to)
+	if err != nil {
+		writeSumError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(total)
+}
+
+// loadOrg fetches the organization from the id URL parameter and checks that
+// the caller may view it. It writes the error response itself and reports
+// whether the handler should continue.
+func (s *OrganizationHandler) loadOrg(w http.ResponseWriter, r *http.Request) (*model.Organization, bool) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if !auth.FromContext(r.Context()).CanViewOrg(idParam) {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	org, err := s.repo.GetByID(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if org == nil {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return org, true
+}
@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+type PlanHandler struct {
+	repo     repository.PlanRepository
+	services repository.ServiceRepository
+}
+
+func NewPlanHandler(repo repository.PlanRepository, services repository.ServiceRepository) *PlanHandler {
+	return &PlanHandler{repo: repo, services: services}
+}
+
+// CreatePlan godoc
+// @Summary Add a plan to a catalog service
+// @Tags plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Service ID"
+// @Param plan body model.Plan true "Plan name, default price and billing period (monthly, quarterly or yearly)"
+// @Success 201 {object} model.Plan
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Service not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /services/{id}/plans [post]
+func (s *PlanHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	svc, ok := s.loadService(w, r)
+	if !ok {
+		return
+	}
+
+	var plan model.Plan
+	if !decodeJSON(w, r, &plan) {
+		return
+	}
+
+	if plan.BillingPeriod == "" {
+		plan.BillingPeriod = model.BillingMonthly
+	}
+	if !resolvePlanCurrency(w, &plan.Price, model.DefaultCurrency) {
+		return
+	}
+	if plan.Name == "" || plan.Price.Amount <= 0 || model.BillingMonths(plan.BillingPeriod) == 0 {
+		http.Error(w, "Invalid request, name, positive price and billing period monthly, quarterly or yearly are required", http.StatusBadRequest)
+		return
+	}
+	plan.ID = uuid.New().String()
+	plan.ServiceID = svc.ID
+	plan.CreatedAt = time.Now()
+
+	if err := s.repo.Create(r.Context(), &plan); err != nil {
+		http.Error(w, "Failed to create plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Plan %s created for service %s", plan.ID, svc.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(plan)
+}
+
+// ListPlans godoc
+// @Summary List the plans of a catalog service
+// @Tags plans
+// @Produce json
+// @Param id path string true "Service ID"
+// @Success 200 {array} model.Plan
+// @Failure 404 {string} string "Service not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /services/{id}/plans [get]
+func (s *PlanHandler) ListPlans(w http.ResponseWriter, r *http.Request) {
+	svc, ok := s.loadService(w, r)
+	if !ok {
+		return
+	}
+
+	plans, err := s.repo.ListByService(r.Context(), svc.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plans)
+}
+
+// GetPlan godoc
+// @Summary Get a plan by ID
+// @Tags plans
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Success 200 {object} model.Plan
+// @Failure 404 {string} string "Plan not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /plans/{id} [get]
+func (s *PlanHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// UpdatePlan godoc
+// @Summary Update a plan
+// @Description Changes the defaults for new subscriptions. Existing subscriptions keep their price, use the reprice endpoint for that
+// @Tags plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Param plan body model.Plan true "Plan data"
+// @Success 200 {object} model.Plan
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Plan not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /plans/{id} [put]
+func (s *PlanHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	existing, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+
+	var plan model.Plan
+	if !decodeJSON(w, r, &plan) {
+		return
+	}
+
+	if plan.Name != "" {
+		existing.Name = plan.Name
+	}
+	if !plan.Price.IsZero() {
+		if !resolvePlanCurrency(w, &plan.Price, existing.Price.Currency) {
+			return
+		}
+		existing.Price = plan.Price
+	}
+	if plan.BillingPeriod != "" {
+		existing.BillingPeriod = plan.BillingPeriod
+	}
+	if existing.Price.Amount <= 0 || model.BillingMonths(existing.BillingPeriod) == 0 {
+		http.Error(w, "Invalid request, price must be positive and billing period monthly, quarterly or yearly", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.repo.Update(r.Context(), existing)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(existing)
+}
+
+// DeletePlan godoc
+// @Summary Delete a plan
+// @Description Subscriptions on the plan keep their price and lose the reference
+// @Tags plans
+// @Param id path string true "Plan ID"
+// @Success 204
+// @Failure 404 {string} string "Plan not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /plans/{id} [delete]
+func (s *PlanHandler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.repo.Delete(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RepricePlan godoc
+// @Summary Re-price all subscriptions on a plan
+// @Description Sets the plan's default price and schedules the new price for every subscription on the plan that has not ended by the effective date and is priced in the plan's currency. Changes effective today or earlier are applied immediately
+// @Tags plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Param reprice body model.Reprice true "New price and effective date (YYYY-MM-DD), today by default"
+// @Success 200 {object} model.Reprice
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Plan not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /plans/{id}/reprice [post]
+func (s *PlanHandler) RepricePlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.Reprice
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	price, err := req.Price.In(plan.Price.Currency)
+	if err != nil {
+		http.Error(w, "Invalid price, it must be in the currency of the plan, "+plan.Price.Currency, http.StatusBadRequest)
+		return
+	}
+	req.Price = price
+	if req.Price.Amount <= 0 {
+		http.Error(w, "Invalid request, price must be positive", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	effective := now
+	if req.EffectiveDate != "" {
+		t, err := req.EffectiveDate.First()
+		if err != nil {
+			http.Error(w, "Invalid effective_date", http.StatusBadRequest)
+			return
+		}
+		effective = t
+	}
+	req.EffectiveDate = model.DateOf(effective)
+
+	scheduled, err := s.repo.Reprice(r.Context(), plan.ID, req.Price, effective)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	applied, err := s.repo.ApplyPriceChanges(r.Context(), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Scheduled = scheduled
+	req.Applied = applied
+
+	logger.FromContext(r.Context()).Infof("Plan %s re-priced to %s %s from %s, %d subscriptions affected", plan.ID, req.Price, req.Price.Currency, req.EffectiveDate, scheduled)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+func (s *PlanHandler) loadPlan(w http.ResponseWriter, r *http.Request) (*model.Plan, bool) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	plan, err := s.repo.GetByID(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if plan == nil {
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return plan, true
+}
+
+func (s *PlanHandler) loadService(w http.ResponseWriter, r *http.Request) (*model.Service, bool) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	svc, err := s.services.GetByID(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if svc == nil {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return svc, true
+}
+
+// resolvePlanCurrency puts price into its own currency, or into currency
+// when it was given without one. On failure it writes the error response and
+// returns false.
+func resolvePlanCurrency(w http.ResponseWriter, price *model.Money, currency string) bool {
+	if price.Currency != "" {
+		currency = price.Currency
+	}
+	if !validCurrency(currency) {
+		http.Error(w, "Invalid currency, use an ISO 4217 code such as RUB", http.StatusBadRequest)
+		return false
+	}
+	p, err := price.In(currency)
+	if err != nil {
+		http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	*price = p
+	return true
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+type ServiceHandler struct {
+	repo repository.ServiceRepository
+}
+
+func NewServiceHandler(repo repository.ServiceRepository) *ServiceHandler {
+	return &ServiceHandler{repo: repo}
+}
+
+// CreateService godoc
+// @Summary Add a service to the catalog
+// @Description Subscriptions whose service_name matches the name or one of the aliases, ignoring case, are linked to the service
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param service body model.Service true "Service data"
+// @Success 201 {object} model.Service
+// @Failure 400 {string} string "Invalid request"
+// @Failure 409 {string} string "Name or alias already used by another service"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /services [post]
+func (s *ServiceHandler) CreateService(w http.ResponseWriter, r *http.Request) {
+	var svc model.Service
+	if !decodeJSON(w, r, &svc) {
+		return
+	}
+
+	if svc.Name == "" {
+		http.Error(w, "Invalid request, name is required", http.StatusBadRequest)
+		return
+	}
+	if !s.checkNames(w, r, &svc) {
+		return
+	}
+	svc.ID = uuid.New().String()
+	svc.CreatedAt = time.Now()
+
+	if err := s.repo.Create(r.Context(), &svc); err != nil {
+		http.Error(w, "Failed to create service: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Service %s created", svc.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(svc)
+}
+
+// ListServices godoc
+// @Summary List the service catalog
+// @Tags services
+// @Produce json
+// @Success 200 {array} model.Service
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /services [get]
+func (s *ServiceHandler) ListServices(w http.ResponseWriter, r *http.Request) {
+	services, err := s.repo.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services)
+}
+
+// GetService godoc
+// @Summary Get a catalog service by ID
+// @Tags services
+// @Produce json
+// @Param id path string true "Service ID"
+// @Success 200 {object} model.Service
+// @Failure 404 {string} string "Service not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /services/{id} [get]
+func (s *ServiceHandler) GetService(w http.ResponseWriter, r *http.Request) {
+	svc, ok := s.loadService(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(svc)
+}
+
+// UpdateService godoc
+// @Summary Update a catalog service
+// @Description Renaming a service also renames the subscriptions linked to it
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param id path string true "Service ID"
+// @Param service body model.Service true "Service data"
+// @Success 200 {object} model.Service
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Service not found"
+// @Failure 409 {string} string "Name or alias already used by another service"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /services/{id} [put]
+func (s *ServiceHandler) UpdateService(w http.ResponseWriter, r *http.Request) {
+	existing, ok := s.loadService(w, r)
+	if !ok {
+		return
+	}
+
+	var svc model.Service
+	if !decodeJSON(w, r, &svc) {
+		return
+	}
+
+	if svc.Name != "" {
+		existing.Name = svc.Name
+	}
+	if svc.Aliases != nil {
+		existing.Aliases = svc.Aliases
+	}
+	if svc.Category != "" {
+		existing.Category = svc.Category
+	}
+	if svc.VendorURL != "" {
+		existing.VendorURL = svc.VendorURL
+	}
+	if !s.checkNames(w, r, existing) {
+		return
+	}
+
+	found, err := s.repo.Update(r.Context(), existing)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Service %s updated", existing.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(existing)
+}
+
+// DeleteService godoc
+// @Summary Remove a service from the catalog
+// @Description Linked subscriptions keep their service_name
+// @Tags services
+// @Param id path string true "Service ID"
+// @Success 204
+// @Failure 404 {string} string "Service not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /services/{id} [delete]
+func (s *ServiceHandler) DeleteService(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.repo.Delete(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkNames makes sure neither the name nor an alias of svc already
+// resolves to a different catalog entry. It writes a 409 response and
+// returns false on a clash.
+func (s *ServiceHandler) checkNames(w http.ResponseWriter, r *http.Request, svc *model.Service) bool {
+	for _, name := range append([]string{svc.Name}, svc.Aliases...) {
+		other, err := s.repo.Resolve(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		if other != nil && other.ID != svc.ID {
+			http.Error(w, "Name "+name+" is already used by service "+other.Name, http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ServiceHandler) loadService(w http.ResponseWriter, r *http.Request) (*model.Service, bool) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	svc, err := s.repo.GetByID(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if svc == nil {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return svc, true
+}
@@ -0,0 +1,429 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/policy"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/zone"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// defaultTimezone is the time zone of users created without one.
+const defaultTimezone = "UTC"
+
+// maxNextCharges limits the next charges in a user summary.
+const maxNextCharges = 5
+
+// UserHandler serves users. Access follows the subscription policy: users
+// with "own" rules only see and change their own record.
+type UserHandler struct {
+	users  repository.UserRepository
+	subs   repository.SubscriptionRepository
+	policy *policy.Policy
+}
+
+func NewUserHandler(users repository.UserRepository, subs repository.SubscriptionRepository, policy *policy.Policy) *UserHandler {
+	return &UserHandler{users: users, subs: subs, policy: policy}
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Description timezone defaults to UTC and currency to RUB. Users limited to their own data can only create their own record, with their ID.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body model.User true "User data"
+// @Success 201 {object} model.User
+// @Failure 400 {string} string "Invalid request"
+// @Failure 403 {string} string "Not allowed"
+// @Failure 409 {string} string "Email already used by another user"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users [post]
+func (s *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var u model.User
+	if !decodeJSON(w, r, &u) {
+		return
+	}
+
+	callerID, ok := checkPolicy(w, r, s.policy, policy.ActionCreate, "users")
+	if !ok {
+		return
+	}
+	if callerID != "" {
+		if u.ID != "" && u.ID != callerID {
+			http.Error(w, "Cannot create other users", http.StatusForbidden)
+			return
+		}
+		u.ID = callerID
+	}
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	} else if _, err := uuid.Parse(u.ID); err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	if msg := validateUser(&u); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	u.CreatedAt = time.Now()
+
+	if err := s.users.Create(r.Context(), &u); err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			http.Error(w, "Email already used by another user", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("User %s created", u.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(u)
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Tags users
+// @Produce json
+// @Success 200 {array} model.User
+// @Failure 403 {string} string "Not allowed"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users [get]
+func (s *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := checkPolicy(w, r, s.policy, policy.ActionList, "users")
+	if !ok {
+		return
+	}
+	if callerID != "" {
+		http.Error(w, "Not allowed to list users", http.StatusForbidden)
+		return
+	}
+
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// GetUser godoc
+// @Summary Get a user by ID
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} model.User
+// @Failure 404 {string} string "User not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id} [get]
+func (s *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.loadUser(w, r, policy.ActionRead)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// UpdateUser godoc
+// @Summary Update a user
+// @Description Changes the name, email, timezone and currency. Empty fields keep their value.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param user body model.User true "User data"
+// @Success 200 {object} model.User
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "User not found"
+// @Failure 409 {string} string "Email already used by another user"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id} [put]
+func (s *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	existing, ok := s.loadUser(w, r, policy.ActionUpdate)
+	if !ok {
+		return
+	}
+
+	var u model.User
+	if !decodeJSON(w, r, &u) {
+		return
+	}
+	if u.Name != "" {
+		existing.Name = u.Name
+	}
+	if u.Email != "" {
+		existing.Email = u.Email
+	}
+	if u.Timezone != "" {
+		existing.Timezone = u.Timezone
+	}
+	if u.Currency != "" {
+		existing.Currency = u.Currency
+	}
+	if msg := validateUser(existing); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.users.Update(r.Context(), existing)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		http.Error(w, "Email already used by another user", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("User %s updated", existing.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(existing)
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description A user who pays for or shares subscriptions, or has budgets, can only be deleted with cascade=true, which deletes their subscriptions and budgets, or with reassign_to, which moves them to another user. Memberships in shared subscriptions are dropped or moved the same way, organization memberships are dropped.
+// @Tags users
+// @Param id path string true "User ID"
+// @Param cascade query bool false "Delete the user's subscriptions and budgets"
+// @Param reassign_to query string false "Move the user's subscriptions and budgets to this user"
+// @Success 204
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "User not found"
+// @Failure 409 {string} string "User has subscriptions or budgets, use cascade or reassign_to"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id} [delete]
+func (s *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	how := repository.UserDeletion{Cascade: q.Get("cascade") == "true", ReassignTo: q.Get("reassign_to")}
+	if how.Cascade && how.ReassignTo != "" {
+		http.Error(w, "Use either cascade or reassign_to, not both", http.StatusBadRequest)
+		return
+	}
+	if how.ReassignTo != "" {
+		if _, err := uuid.Parse(how.ReassignTo); err != nil {
+			http.Error(w, "Invalid reassign_to", http.StatusBadRequest)
+			return
+		}
+	}
+
+	u, ok := s.loadUser(w, r, policy.ActionDelete)
+	if !ok {
+		return
+	}
+	if how.ReassignTo == u.ID {
+		http.Error(w, "Cannot reassign to the deleted user", http.StatusBadRequest)
+		return
+	}
+
+	ctx := logger.WithFields(r.Context(), log.Fields{"user_id": u.ID})
+	_, err := s.users.Delete(ctx, u.ID, how)
+	switch {
+	case errors.Is(err, repository.ErrUserHasSubscriptions):
+		http.Error(w, "User has subscriptions or budgets, use cascade=true or reassign_to", http.StatusConflict)
+		return
+	case errors.Is(err, repository.ErrUnknownUser):
+		http.Error(w, "Unknown reassign_to user", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(ctx).Infof("User deleted, cascade=%t reassign_to=%q", how.Cascade, how.ReassignTo)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUserSubscriptions godoc
+// @Summary List the subscriptions of a user
+// @Description Same as GET /subscriptions?user_id=, including the computed next_charge_date
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Param tag query string false "Only subscriptions with this tag"
+// @Param category query string false "Only subscriptions in this category"
+// @Success 200 {array} model.Subscription
+// @Failure 404 {string} string "User not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/subscriptions [get]
+func (s *UserHandler) GetUserSubscriptions(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.loadUser(w, r, policy.ActionList)
+	if !ok {
+		return
+	}
+
+	ctx := logger.WithFields(zone.WithLocation(r.Context(), zone.Load(u.Timezone)), log.Fields{"user_id": u.ID})
+	subs, err := s.subs.ListByUser(ctx, u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	subs = filterLabels(subs, r.URL.Query().Get("tag"), r.URL.Query().Get("category"))
+	if subs == nil {
+		subs = []*model.Subscription{}
+	}
+	setNextCharge(ctx, subs...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+// GetUserSummary godoc
+// @Summary Overview of a user's subscriptions
+// @Description active_count counts the subscriptions the user pays for that are active or in trial today. monthly_spend is the user's share of the charges due this month, as /subscriptions/total computes it. next_charges are the next charges of the subscriptions the user pays for, at most 5.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} model.UserSummary
+// @Failure 404 {string} string "User not found"
+// @Failure 422 {string} string "Subscriptions in different currencies"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/summary [get]
+func (s *UserHandler) GetUserSummary(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.loadUser(w, r, policy.ActionTotal)
+	if !ok {
+		return
+	}
+
+	ctx := logger.WithFields(zone.WithLocation(r.Context(), zone.Load(u.Timezone)), log.Fields{"user_id": u.ID})
+	day := today(ctx)
+	first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1)
+
+	subs, err := s.subs.ListInvolving(ctx, u.ID, nil, first, last)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	owned, err := s.subs.ListByUser(ctx, u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	spend, err := billing.ShareTotal(subs, u.ID, first, last)
+	if err != nil {
+		writeSumError(w, err)
+		return
+	}
+	if spend.Currency == "" {
+		spend.Currency = u.Currency
+	}
+
+	summary := model.UserSummary{
+		UserID:       u.ID,
+		MonthlySpend: spend,
+		NextCharges:  []model.ChargeEvent{},
+	}
+	for _, sub := range owned {
+		if sub.Status != model.StatusActive && sub.Status != model.StatusTrial {
+			continue
+		}
+		summary.ActiveCount++
+		if c, ok := billing.NextCharge(sub, day); ok {
+			summary.NextCharges = append(summary.NextCharges, model.ChargeEvent{
+				SubscriptionID: sub.ID,
+				ServiceName:    sub.ServiceName,
+				UserID:         sub.UserID,
+				Date:           model.DateOf(c.Date),
+				Amount:         c.Amount,
+			})
+		}
+	}
+	sort.Slice(summary.NextCharges, func(i, j int) bool { return summary.NextCharges[i].Date < summary.NextCharges[j].Date })
+	if len(summary.NextCharges) > maxNextCharges {
+		summary.NextCharges = summary.NextCharges[:maxNextCharges]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// loadUser checks the policy for action and loads the user named in the
+// path. Other users are reported as not found to callers limited to their
+// own data.
+func (s *UserHandler) loadUser(w http.ResponseWriter, r *http.Request, action policy.Action) (*model.User, bool) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	callerID, ok := checkPolicy(w, r, s.policy, action, "users")
+	if !ok {
+		return nil, false
+	}
+
+	u, err := s.users.GetByID(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if u == nil || (callerID != "" && u.ID != callerID) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return u, true
+}
+
+// validateUser fills the defaults of u and returns an error message for an
+// invalid user, or "".
+func validateUser(u *model.User) string {
+	if u.Timezone == "" {
+		u.Timezone = defaultTimezone
+	}
+	if u.Currency == "" {
+		u.Currency = model.DefaultCurrency
+	}
+	u.Currency = strings.ToUpper(u.Currency)
+
+	if u.Email != "" {
+		addr, err := mail.ParseAddress(u.Email)
+		if err != nil || addr.Address != u.Email {
+			return "Invalid email"
+		}
+	}
+	if _, err := time.LoadLocation(u.Timezone); err != nil {
+		return "Invalid timezone, use an IANA name such as Europe/Moscow"
+	}
+	if !validCurrency(u.Currency) {
+		return "Invalid currency, use an ISO 4217 code such as RUB"
+	}
+	return ""
+}
+
+// validCurrency reports whether currency looks like an ISO 4217 code.
+func validCurrency(currency string) bool {
+	return len(currency) == 3 && strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
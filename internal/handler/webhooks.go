@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type WebhookHandler struct {
+	repo repository.WebhookRepository
+}
+
+func NewWebhookHandler(repo repository.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{repo: repo}
+}
+
+// CreateWebhook godoc
+// @Summary Register a webhook endpoint
+// @Description Events are POSTed as JSON with an X-Webhook-Signature header "t=<unix>,v1=<hex HMAC-SHA256 of "<unix>.<body>">" keyed by the secret. A secret is generated when none is given; it is returned only in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body model.Webhook true "URL, events and optional secret"
+// @Success 201 {object} model.Webhook
+// @Failure 400 {string} string "Invalid request"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks [post]
+func (s *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook model.Webhook
+	if !decodeJSON(w, r, &hook) {
+		return
+	}
+
+	if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid url, must be an http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if len(hook.Events) == 0 {
+		http.Error(w, "Invalid request, events are required", http.StatusBadRequest)
+		return
+	}
+	for _, event := range hook.Events {
+		if !slices.Contains(model.Events, event) {
+			http.Error(w, "Unknown event "+event, http.StatusBadRequest)
+			return
+		}
+	}
+	if hook.Secret == "" {
+		buf := make([]byte, 32)
+		rand.Read(buf)
+		hook.Secret = hex.EncodeToString(buf)
+	}
+	hook.ID = uuid.New().String()
+	hook.CreatedAt = time.Now()
+
+	if err := s.repo.Create(r.Context(), &hook); err != nil {
+		http.Error(w, "Failed to create webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Webhook %s registered", hook.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// ListWebhooks godoc
+// @Summary List webhook endpoints
+// @Description Secrets are never returned.
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} model.Webhook
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks [get]
+func (s *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := s.repo.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook endpoint by ID
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} model.Webhook
+// @Failure 404 {string} string "Webhook not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks/{id} [get]
+func (s *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	hook.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhook godoc
+// @Summary Remove a webhook endpoint and its delivery log
+// @Tags webhooks
+// @Param id path string true "Webhook ID"
+// @Success 204
+// @Failure 404 {string} string "Webhook not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks/{id} [delete]
+func (s *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := s.repo.Delete(r.Context(), hook.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Webhook %s removed", hook.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries godoc
+// @Summary Delivery log of a webhook
+// @Description Latest deliveries first, with their attempts, last error and response code. Deliveries that ran out of attempts have status dead.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "Only deliveries with this status: pending, delivered or dead"
+// @Param limit query int false "Maximum number of deliveries, 50 by default, at most 500"
+// @Success 200 {array} model.Delivery
+// @Failure 400 {string} string "Invalid status or limit"
+// @Failure 404 {string} string "Webhook not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks/{id}/deliveries [get]
+func (s *WebhookHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+	default:
+		http.Error(w, "Invalid status, want pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			http.Error(w, "Invalid limit, must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	hook, ok := s.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := s.repo.ListDeliveries(r.Context(), hook.ID, status, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RedeliverWebhookDelivery godoc
+// @Summary Retry a dead delivery
+// @Description Moves a dead delivery back to pending with a fresh set of attempts
+// @Tags webhooks
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 202
+// @Failure 404 {string} string "Webhook or dead delivery not found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (s *WebhookHandler) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	deliveryID := chi.URLParam(r, "delivery_id")
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		http.Error(w, "Invalid delivery_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.repo.Redeliver(r.Context(), hook.ID, deliveryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Dead delivery not found", http.StatusNotFound)
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Delivery %s of webhook %s requeued", deliveryID, hook.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *WebhookHandler) loadWebhook(w http.ResponseWriter, r *http.Request) (*model.Webhook, bool) {
+	idParam := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(idParam); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	hook, err := s.repo.GetByID(r.Context(), idParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if hook == nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return hook, true
+}
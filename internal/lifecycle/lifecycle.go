@@ -0,0 +1,97 @@
+// Package lifecycle defines the statuses of a subscription and the
+// transitions allowed between them.
+//
+// Only active, paused and cancelled are stored. A stored active
+// subscription is reported as trial during its trial and as expired once
+// its end date has passed.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+type Action string
+
+const (
+	ActionPause  Action = "pause"
+	ActionResume Action = "resume"
+	ActionCancel Action = "cancel"
+)
+
+// ErrInvalidTransition is returned for actions not allowed in the current
+// status, such as resuming an active subscription.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists the statuses each action may start from and the stored
+// status it leads to.
+var transitions = map[Action]struct {
+	from []string
+	to   string
+}{
+	ActionPause:  {from: []string{model.StatusTrial, model.StatusActive}, to: model.StatusPaused},
+	ActionResume: {from: []string{model.StatusPaused}, to: model.StatusActive},
+	ActionCancel: {from: []string{model.StatusTrial, model.StatusActive, model.StatusPaused}, to: model.StatusCancelled},
+}
+
+// Current returns the status of sub on day given its stored status.
+func Current(stored string, sub *model.Subscription, day time.Time) string {
+	if stored != model.StatusActive {
+		return stored
+	}
+	if end, err := sub.EndDate.Last(); err == nil && end.Before(day) {
+		return model.StatusExpired
+	}
+	if billing.InTrial(sub, day) {
+		return model.StatusTrial
+	}
+	return model.StatusActive
+}
+
+// Stored maps a reported status back to the value kept in the database.
+func Stored(status string) string {
+	switch status {
+	case model.StatusTrial, model.StatusExpired:
+		return model.StatusActive
+	}
+	return status
+}
+
+// Next returns the stored status action leads to from current, or
+// ErrInvalidTransition.
+func Next(current string, action Action) (string, error) {
+	t, ok := transitions[action]
+	if !ok {
+		return "", fmt.Errorf("unknown action %q", action)
+	}
+	for _, from := range t.from {
+		if from == current {
+			return t.to, nil
+		}
+	}
+	return "", fmt.Errorf("%w: cannot %s a subscription that is %s", ErrInvalidTransition, action, current)
+}
+
+// CancelEndDate returns the end date of sub when it is cancelled on day.
+// Cancelling immediately ends it on day; otherwise it runs until the day
+// before its next charge, the end of the period already paid for.
+func CancelEndDate(sub *model.Subscription, day time.Time, immediate bool) time.Time {
+	end := day
+	if !immediate {
+		if next, ok := billing.NextCharge(sub, day.AddDate(0, 0, 1)); ok {
+			end = next.Date.AddDate(0, 0, -1)
+		}
+	}
+
+	if start, err := sub.StartDate.First(); err == nil && end.Before(start) {
+		end = start
+	}
+	if current, err := sub.EndDate.Last(); err == nil && current.Before(end) {
+		end = current
+	}
+	return end
+}
@@ -0,0 +1,82 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestCurrent(t *testing.T) {
+	sub := &model.Subscription{StartDate: "2026-01-01", TrialEndDate: "2026-01-15", EndDate: "2026-06-30"}
+
+	cases := []struct {
+		stored string
+		day    string
+		want   string
+	}{
+		{model.StatusActive, "2026-01-10", model.StatusTrial},
+		{model.StatusActive, "2026-02-01", model.StatusActive},
+		{model.StatusActive, "2026-07-01", model.StatusExpired},
+		{model.StatusPaused, "2026-02-01", model.StatusPaused},
+		{model.StatusCancelled, "2026-07-01", model.StatusCancelled},
+	}
+	for _, c := range cases {
+		if got := Current(c.stored, sub, date(c.day)); got != c.want {
+			t.Errorf("Current(%s, %s) = %s, want %s", c.stored, c.day, got, c.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	allowed := []struct {
+		from   string
+		action Action
+		to     string
+	}{
+		{model.StatusActive, ActionPause, model.StatusPaused},
+		{model.StatusTrial, ActionPause, model.StatusPaused},
+		{model.StatusPaused, ActionResume, model.StatusActive},
+		{model.StatusPaused, ActionCancel, model.StatusCancelled},
+		{model.StatusActive, ActionCancel, model.StatusCancelled},
+	}
+	for _, c := range allowed {
+		to, err := Next(c.from, c.action)
+		if err != nil || to != c.to {
+			t.Errorf("Next(%s, %s) = %s, %v, want %s", c.from, c.action, to, err, c.to)
+		}
+	}
+
+	denied := []struct {
+		from   string
+		action Action
+	}{
+		{model.StatusActive, ActionResume},
+		{model.StatusPaused, ActionPause},
+		{model.StatusCancelled, ActionResume},
+		{model.StatusCancelled, ActionCancel},
+		{model.StatusExpired, ActionPause},
+	}
+	for _, c := range denied {
+		if _, err := Next(c.from, c.action); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Next(%s, %s) should be an invalid transition, got %v", c.from, c.action, err)
+		}
+	}
+}
+
+func TestCancelEndDate(t *testing.T) {
+	sub := &model.Subscription{Price: model.Money{Amount: 100, Currency: "RUB"}, BillingPeriod: model.BillingMonthly, StartDate: "2026-01-10"}
+
+	if got := CancelEndDate(sub, date("2026-03-20"), false); !got.Equal(date("2026-04-09")) {
+		t.Errorf("At period end: got %s, want 2026-04-09", got.Format("2006-01-02"))
+	}
+	if got := CancelEndDate(sub, date("2026-03-20"), true); !got.Equal(date("2026-03-20")) {
+		t.Errorf("Immediate: got %s, want 2026-03-20", got.Format("2006-01-02"))
+	}
+}
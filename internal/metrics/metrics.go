@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+const namespace = "subscription_service"
+
+var (
+	httpRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route pattern and status code.",
+		},
+		[]string{"method", "route", "status"},
+	)
+
+	httpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method", "route"},
+	)
+
+	queryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_query_duration_seconds",
+			Help:      "Duration of repository method calls.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+		[]string{"method"},
+	)
+
+	queryErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_query_errors_total",
+			Help:      "Number of failed repository method calls.",
+		},
+		[]string{"method"},
+	)
+)
+
+// SummaryFunc returns the number of currently active subscriptions and
+// their combined monthly price per currency.
+type SummaryFunc func() (active int, monthlySpend map[string]model.Money, err error)
+
+// Register adds all service metrics to the default Prometheus registry.
+func Register(db *sql.DB, summary SummaryFunc) {
+	prometheus.MustRegister(
+		httpRequests,
+		httpDuration,
+		queryDuration,
+		queryErrors,
+		collectors.NewDBStatsCollector(db, "subscriptions"),
+		newBusinessCollector(summary),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records request counts and latency per chi route pattern.
+// The pattern is used instead of the raw path so that IDs in the URL
+// do not blow up label cardinality.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveQuery records the duration and outcome of a repository method call.
+func ObserveQuery(method string, start time.Time, err error) {
+	queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		queryErrors.WithLabelValues(method).Inc()
+	}
+}
+
+type businessCollector struct {
+	summary SummaryFunc
+	active  *prometheus.Desc
+	spend   *prometheus.Desc
+}
+
+func newBusinessCollector(summary SummaryFunc) *businessCollector {
+	return &businessCollector{
+		summary: summary,
+		active: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "active_subscriptions"),
+			"Number of subscriptions active today.",
+			nil, nil,
+		),
+		spend: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "monthly_spend"),
+			"Combined monthly price of subscriptions active today, in major units per currency.",
+			[]string{"currency"}, nil,
+		),
+	}
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.spend
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	active, spend, err := c.summary()
+	if err != nil {
+		logger.L().Errorf("Error collecting business metrics: %v", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(active))
+	for currency, amount := range spend {
+		ch <- prometheus.MustNewConstMetric(c.spend, prometheus.GaugeValue, amount.Float(), currency)
+	}
+}
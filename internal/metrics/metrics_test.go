@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareUsesRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/4658b3ad-0323-4d4d-854c-05da025bf9ef", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/subscriptions/{id}", "404"))
+	if got != 1 {
+		t.Errorf("Expected 1 request for route pattern, got %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Budget caps the monthly spend of a user, or of an organization when
+// UserID is empty, either overall or for one service or category.
+type Budget struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id,omitempty" example:"60601fee-2bf1-4721-ae6f-7636e79a0cba"`
+	OrgID       string    `json:"org_id,omitempty"`
+	ServiceName string    `json:"service_name,omitempty" example:"Yandex Plus"`
+	Category    string    `json:"category,omitempty" example:"streaming"`
+	Amount      Money     `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BudgetStatus is the spend against a budget in one month. Spent counts
+// every charge due in the month, including those still to come.
+type BudgetStatus struct {
+	BudgetID    string `json:"budget_id"`
+	Month       string `json:"month" example:"2026-03"`
+	Amount      Money  `json:"amount"`
+	Spent       Money  `json:"spent"`
+	Remaining   Money  `json:"remaining"`
+	Utilisation int    `json:"utilisation" example:"85"`
+	Threshold   int    `json:"threshold" example:"80"`
+}
+
+// BudgetAlert is sent when a subscription change pushes a budget's monthly
+// spend past one of the alert thresholds.
+type BudgetAlert struct {
+	Budget         *Budget      `json:"budget"`
+	Status         BudgetStatus `json:"status"`
+	SubscriptionID string       `json:"subscription_id"`
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// ErrInvalidDate is returned for dates in none of the accepted forms.
+var ErrInvalidDate = errors.New("invalid date, use YYYY-MM-DD, YYYY-MM or MM-YYYY")
+
+// Date is a calendar date of the API: a day, YYYY-MM-DD, or a whole month,
+// YYYY-MM. Months are also accepted as MM-YYYY and stored as YYYY-MM.
+//
+// A month covers all its days: as the start of a period it means its first
+// day, as the end of a period its last day, both inclusive.
+type Date string
+
+// ParseDate parses s in any of the accepted forms and returns it in the
+// canonical one.
+func ParseDate(s string) (Date, error) {
+	if t, err := time.Parse(dayLayout, s); err == nil {
+		return Date(t.Format(dayLayout)), nil
+	}
+	for _, layout := range []string{monthLayout, "01-2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Date(t.Format(monthLayout)), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidDate, s)
+}
+
+// DateOf returns the day of t.
+func DateOf(t time.Time) Date {
+	return Date(t.Format(dayLayout))
+}
+
+// IsMonth reports whether d is a whole month rather than a day.
+func (d Date) IsMonth() bool {
+	p, err := ParseDate(string(d))
+	return err == nil && len(p) == len(monthLayout)
+}
+
+// First returns the first day of d at midnight UTC.
+func (d Date) First() (time.Time, error) {
+	p, err := ParseDate(string(d))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(p) == len(monthLayout) {
+		return time.Parse(monthLayout, string(p))
+	}
+	return time.Parse(dayLayout, string(p))
+}
+
+// Last returns the last day of d at midnight UTC, the end of the month for
+// a month.
+func (d Date) Last() (time.Time, error) {
+	t, err := d.First()
+	if err != nil || !d.IsMonth() {
+		return t, err
+	}
+	return t.AddDate(0, 1, -1), nil
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		*d = ""
+		return err
+	}
+	p, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = p
+	return nil
+}
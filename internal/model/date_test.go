@@ -0,0 +1,51 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDate(t *testing.T) {
+	cases := []struct {
+		in, want, first, last string
+	}{
+		{"2025-07-15", "2025-07-15", "2025-07-15", "2025-07-15"},
+		{"2025-07", "2025-07", "2025-07-01", "2025-07-31"},
+		{"07-2025", "2025-07", "2025-07-01", "2025-07-31"},
+		{"02-2024", "2024-02", "2024-02-01", "2024-02-29"},
+	}
+	for _, c := range cases {
+		d, err := ParseDate(c.in)
+		if err != nil || string(d) != c.want {
+			t.Errorf("ParseDate(%q) = %q, %v, want %q", c.in, d, err, c.want)
+			continue
+		}
+		first, _ := d.First()
+		last, _ := d.Last()
+		if DateOf(first) != Date(c.first) || DateOf(last) != Date(c.last) {
+			t.Errorf("%q covers %s to %s, want %s to %s", c.in, DateOf(first), DateOf(last), c.first, c.last)
+		}
+	}
+
+	for _, in := range []string{"", "2025-13", "13-2025", "2025-02-30", "2025/07/01"} {
+		if _, err := ParseDate(in); err == nil {
+			t.Errorf("ParseDate(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestDateJSON(t *testing.T) {
+	var v struct {
+		Start Date `json:"start"`
+		End   Date `json:"end"`
+	}
+	if err := json.Unmarshal([]byte(`{"start": "07-2025", "end": null}`), &v); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if v.Start != "2025-07" || v.End != "" {
+		t.Errorf("Got %q and %q", v.Start, v.End)
+	}
+	if err := json.Unmarshal([]byte(`{"start": "July 2025"}`), &v); err == nil {
+		t.Errorf("Expected an error for an invalid date")
+	}
+}
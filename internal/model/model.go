@@ -2,14 +2,125 @@ package model
 
 import "time"
 
+// Subscription statuses. Only active, paused and cancelled are stored;
+// trial and expired are derived from the dates.
+const (
+	StatusTrial     = "trial"
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+// Transition records a status change of a subscription. EffectiveDate is
+// the day the change applies to billing.
+type Transition struct {
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	EffectiveDate Date      `json:"effective_date"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
 type Subscription struct {
 	// @json id
 	// @format uuid
-	ID          string    `json:"id" example:"4658b3ad-0323-4d4d-854c-05da025bf9ef"`
-	ServiceName string    `json:"service_name"`
-	Price       int       `json:"price"`
-	UserID      string    `json:"user_id"`
-	StartDate   string    `json:"start_date"`
-	EndDate     string    `json:"end_date"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID             string        `json:"id" example:"4658b3ad-0323-4d4d-854c-05da025bf9ef"`
+	ServiceName    string        `json:"service_name"`
+	ServiceID      string        `json:"service_id,omitempty"`
+	PlanID         string        `json:"plan_id,omitempty"`
+	Price          Money         `json:"price"`
+	BillingPeriod  string        `json:"billing_period"`
+	UserID         string        `json:"user_id"`
+	OrgID          string        `json:"org_id,omitempty"`
+	Category       string        `json:"category,omitempty" example:"streaming"`
+	Tags           []string      `json:"tags,omitempty" example:"family,work"`
+	Members        []Member      `json:"members,omitempty"`
+	StartDate      Date          `json:"start_date" example:"2026-01-01"`
+	EndDate        Date          `json:"end_date"`
+	TrialEndDate   Date          `json:"trial_end_date,omitempty"`
+	IntroPrice     *Money        `json:"intro_price,omitempty"`
+	IntroMonths    int           `json:"intro_months,omitempty"`
+	Status         string        `json:"status"`
+	Transitions    []Transition  `json:"transitions,omitempty"`
+	PriceChanges   []PriceChange `json:"price_changes,omitempty"`
+	NextChargeDate Date          `json:"next_charge_date,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// Member shares the cost of a subscription paid by its user. A member pays
+// either a fixed Amount of every charge or a part proportional to Weight.
+type Member struct {
+	UserID string `json:"user_id" example:"60601fee-2bf1-4721-ae6f-7636e79a0cba"`
+	Weight int    `json:"weight,omitempty" example:"1"`
+	Amount *Money `json:"amount,omitempty"`
+}
+
+// Debt is what one user owes another for shared subscriptions.
+type Debt struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount Money  `json:"amount"`
+}
+
+// Balances sums what the members of the subscriptions shared with a user
+// owe them over a period, and what they owe the payers of subscriptions
+// shared with them. Debts are netted per pair of users.
+type Balances struct {
+	UserID string `json:"user_id"`
+	From   Date   `json:"from"`
+	To     Date   `json:"to"`
+	Owed   Money  `json:"owed"`
+	Owes   Money  `json:"owes"`
+	Debts  []Debt `json:"debts"`
+}
+
+// Total is the spend of a period, optionally also per tag or category.
+type Total struct {
+	Total  Money        `json:"total"`
+	Groups []GroupTotal `json:"groups,omitempty"`
+}
+
+// GroupTotal is the spend of the subscriptions with one tag or category.
+// Name is empty for the subscriptions without one. A subscription with
+// several tags counts towards each of them.
+type GroupTotal struct {
+	Name  string `json:"name"`
+	Total Money  `json:"total"`
+}
+
+// ChargeEvent is a projected payment of a subscription.
+type ChargeEvent struct {
+	SubscriptionID string `json:"subscription_id"`
+	ServiceName    string `json:"service_name"`
+	UserID         string `json:"user_id"`
+	Date           Date   `json:"date"`
+	Amount         Money  `json:"amount"`
+}
+
+// MonthAmount is the spend in one calendar month.
+type MonthAmount struct {
+	Month  string `json:"month" example:"2026-03"`
+	Amount Money  `json:"amount"`
+}
+
+// Forecast is the projected spend per calendar month, in total and, when
+// requested, per user.
+type Forecast struct {
+	Months []MonthAmount  `json:"months"`
+	Total  Money          `json:"total"`
+	Users  []UserForecast `json:"users,omitempty"`
+}
+
+type UserForecast struct {
+	UserID string        `json:"user_id"`
+	Months []MonthAmount `json:"months"`
+	Total  Money         `json:"total"`
+}
+
+// DuplicateGroup is a set of subscriptions for the same service whose date
+// ranges overlap. UserID is empty when the group spans an organization.
+type DuplicateGroup struct {
+	UserID        string          `json:"user_id,omitempty"`
+	ServiceName   string          `json:"service_name"`
+	Subscriptions []*Subscription `json:"subscriptions"`
 }
@@ -0,0 +1,226 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts given without one and of
+// users created without one.
+const DefaultCurrency = "RUB"
+
+var (
+	// ErrInvalidMoney is returned for amounts that are not decimal numbers
+	// with at most as many fractional digits as their currency has.
+	ErrInvalidMoney = errors.New("invalid amount, use a decimal such as \"399.99\"")
+	// ErrMixedCurrencies is returned when amounts in different currencies
+	// would have to be added up.
+	ErrMixedCurrencies = errors.New("amounts in different currencies cannot be added up")
+)
+
+// Money is an amount in the minor units of its currency, kopecks for RUB
+// and cents for USD. It is encoded in JSON as an object with the amount as
+// a decimal string, {"amount": "399.99", "currency": "RUB"}.
+//
+// An amount may also be given as a bare decimal string or number, "399.99"
+// or 399.99, in which case it has no currency until In assigns one.
+type Money struct {
+	Amount   int64  `json:"amount" swaggertype:"string" example:"399.99"`
+	Currency string `json:"currency,omitempty" example:"RUB"`
+}
+
+// MinorDigits returns the number of minor unit digits of currency, 2 for
+// most currencies.
+func MinorDigits(currency string) int {
+	switch currency {
+	case "BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG", "RWF", "UGX", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0
+	case "BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND":
+		return 3
+	}
+	return 2
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for range n {
+		p *= 10
+	}
+	return p
+}
+
+// ParseMoney parses a decimal amount in currency, or in the default number
+// of minor digits when currency is empty.
+func ParseMoney(s, currency string) (Money, error) {
+	digits := MinorDigits(currency)
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	neg := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+	if whole == "" || len(frac) > digits || strings.ContainsAny(whole+frac, "+-") {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if neg {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String formats m as a decimal without the currency.
+func (m Money) String() string {
+	digits := MinorDigits(m.Currency)
+	s := strconv.FormatInt(m.Amount, 10)
+	sign := ""
+	if m.Amount < 0 {
+		sign, s = "-", s[1:]
+	}
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// Float returns m in major units as a float, for metrics and other places
+// where an approximate value is enough.
+func (m Money) Float() float64 {
+	return float64(m.Amount) / float64(pow10(MinorDigits(m.Currency)))
+}
+
+// In returns m in currency. An amount parsed without a currency is taken
+// to be in currency; one in another currency is an error.
+func (m Money) In(currency string) (Money, error) {
+	switch m.Currency {
+	case currency:
+		return m, nil
+	case "":
+	default:
+		return Money{}, ErrMixedCurrencies
+	}
+
+	from, to := MinorDigits(""), MinorDigits(currency)
+	switch {
+	case to > from:
+		m.Amount *= pow10(to - from)
+	case to < from:
+		scale := pow10(from - to)
+		if m.Amount%scale != 0 {
+			return Money{}, fmt.Errorf("%w: %s has %d minor digits", ErrInvalidMoney, currency, to)
+		}
+		m.Amount /= scale
+	}
+	m.Currency = currency
+	return m, nil
+}
+
+// Add returns the sum of m and o. An amount without a currency takes the
+// currency of the other; callers check that currencies match beforehand.
+func (m Money) Add(o Money) Money {
+	if m.Currency == "" {
+		m.Currency = o.Currency
+	}
+	m.Amount += o.Amount
+	return m
+}
+
+// Sub returns m minus o.
+func (m Money) Sub(o Money) Money {
+	o.Amount = -o.Amount
+	return m.Add(o)
+}
+
+// Prorate returns m * num / den rounded to the nearest minor unit, halves
+// to even, so that rounding errors do not pile up in one direction over
+// many prorated amounts.
+func (m Money) Prorate(num, den int64) Money {
+	if den == 0 {
+		return Money{Currency: m.Currency}
+	}
+	q := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	d := big.NewInt(den)
+	if d.Sign() < 0 {
+		q.Neg(q)
+		d.Neg(d)
+	}
+	r := new(big.Int)
+	q.DivMod(q, d, r) // floor division, 0 <= r < d
+
+	// Round up when the remainder is over half, or exactly half and the
+	// quotient is odd.
+	switch c := new(big.Int).Lsh(r, 1).Cmp(d); {
+	case c > 0, c == 0 && q.Bit(0) == 1:
+		q.Add(q, big.NewInt(1))
+	}
+	return Money{Amount: q.Int64(), Currency: m.Currency}
+}
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+	if o.Amount < m.Amount {
+		return o
+	}
+	return m
+}
+
+// IsZero reports whether m is the zero value, so that omitzero leaves out
+// unset amounts.
+func (m Money) IsZero() bool {
+	return m == Money{}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency,omitempty"`
+	}{m.String(), m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if string(b) == "null" {
+		return nil
+	}
+	currency := ""
+	if len(b) > 0 && b[0] == '{' {
+		var v struct {
+			Amount   json.RawMessage `json:"amount"`
+			Currency string          `json:"currency"`
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		b, currency = bytes.TrimSpace(v.Amount), strings.ToUpper(strings.TrimSpace(v.Currency))
+	}
+
+	var s string
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidMoney, b)
+		}
+		s = n.String()
+	}
+
+	p, err := ParseMoney(s, currency)
+	if err != nil {
+		return err
+	}
+	*m = p
+	return nil
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in, currency string
+		want         int64
+		str          string
+	}{
+		{"399.99", "RUB", 39999, "399.99"},
+		{"399.9", "RUB", 39990, "399.90"},
+		{"399", "RUB", 39900, "399.00"},
+		{"0.05", "USD", 5, "0.05"},
+		{"-1.50", "USD", -150, "-1.50"},
+		{"1500", "JPY", 1500, "1500"},
+		{"1.5", "KWD", 1500, "1.500"},
+	}
+	for _, c := range cases {
+		m, err := ParseMoney(c.in, c.currency)
+		if err != nil || m.Amount != c.want || m.String() != c.str {
+			t.Errorf("ParseMoney(%q, %s) = %d (%s), %v, want %d (%s)", c.in, c.currency, m.Amount, m, err, c.want, c.str)
+		}
+	}
+
+	for _, in := range []string{"", "1.999", "1.5.0", "abc", "--1", "1e3"} {
+		if _, err := ParseMoney(in, "RUB"); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("ParseMoney(%q) = %v, want ErrInvalidMoney", in, err)
+		}
+	}
+	if _, err := ParseMoney("1.5", "JPY"); err == nil {
+		t.Errorf("Expected an error for fractional yen")
+	}
+}
+
+func TestMoneyIn(t *testing.T) {
+	bare, _ := ParseMoney("12.30", "")
+	if m, err := bare.In("RUB"); err != nil || m != (Money{Amount: 1230, Currency: "RUB"}) {
+		t.Errorf("In(RUB) = %+v, %v", m, err)
+	}
+	if m, err := bare.In("KWD"); err != nil || m != (Money{Amount: 12300, Currency: "KWD"}) {
+		t.Errorf("In(KWD) = %+v, %v", m, err)
+	}
+	if _, err := bare.In("JPY"); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("Expected ErrInvalidMoney for fractional yen, got %v", err)
+	}
+	whole, _ := ParseMoney("1500", "")
+	if m, err := whole.In("JPY"); err != nil || m != (Money{Amount: 1500, Currency: "JPY"}) {
+		t.Errorf("In(JPY) = %+v, %v", m, err)
+	}
+	if _, err := (Money{Amount: 100, Currency: "USD"}).In("RUB"); !errors.Is(err, ErrMixedCurrencies) {
+		t.Errorf("Expected ErrMixedCurrencies, got %v", err)
+	}
+}
+
+func TestMoneyProrate(t *testing.T) {
+	cases := []struct {
+		amount, num, den, want int64
+	}{
+		{999, 1, 3, 333},
+		{1000, 1, 12, 83},
+		{1000, 1, 3, 333},
+		{1001, 1, 2, 500}, // 500.5 rounds to even
+		{1003, 1, 2, 502}, // 501.5 rounds to even
+		{1005, 1, 2, 502}, // 502.5 rounds to even
+		{-1003, 1, 2, -502},
+		{150, 2, 3, 100},
+	}
+	for _, c := range cases {
+		got := Money{Amount: c.amount, Currency: "RUB"}.Prorate(c.num, c.den)
+		if got != (Money{Amount: c.want, Currency: "RUB"}) {
+			t.Errorf("%d * %d / %d = %d, want %d", c.amount, c.num, c.den, got.Amount, c.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		Object Money  `json:"object"`
+		String Money  `json:"string"`
+		Number Money  `json:"number"`
+		Null   *Money `json:"null"`
+	}
+	in := `{"object": {"amount": "399.99", "currency": "rub"}, "string": "9.90", "number": 500, "null": null}`
+	if err := json.Unmarshal([]byte(in), &v); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if v.Object != (Money{Amount: 39999, Currency: "RUB"}) || v.String != (Money{Amount: 990}) ||
+		v.Number != (Money{Amount: 50000}) || v.Null != nil {
+		t.Errorf("Got %+v", v)
+	}
+
+	out, err := json.Marshal(v.Object)
+	if err != nil || string(out) != `{"amount":"399.99","currency":"RUB"}` {
+		t.Errorf("Marshal = %s, %v", out, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"object": "3.999"}`), &v); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("Expected ErrInvalidMoney, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	OrgRoleMember = "member"
+	OrgRoleHead   = "head"
+)
+
+// Organization groups users. Timezone is an IANA zone name used for
+// requests about the organization as a whole.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Timezone  string    `json:"timezone" example:"Europe/Moscow"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrgMember struct {
+	OrgID     string    `json:"org_id"`
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MemberTotal struct {
+	UserID string `json:"user_id"`
+	Total  Money  `json:"total"`
+}
+
+type OrgTotal struct {
+	OrgID   string        `json:"org_id"`
+	Total   Money         `json:"total"`
+	Members []MemberTotal `json:"members"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+const (
+	BillingMonthly   = "monthly"
+	BillingQuarterly = "quarterly"
+	BillingYearly    = "yearly"
+)
+
+// BillingMonths returns the length of a billing period in months, or 0 for
+// an unknown period.
+func BillingMonths(period string) int {
+	switch period {
+	case BillingMonthly:
+		return 1
+	case BillingQuarterly:
+		return 3
+	case BillingYearly:
+		return 12
+	}
+	return 0
+}
+
+// Plan is a tier of a catalog service, such as "Basic" or "Family", with
+// the price new subscriptions on it get by default.
+type Plan struct {
+	ID            string    `json:"id"`
+	ServiceID     string    `json:"service_id"`
+	Name          string    `json:"name"`
+	Price         Money     `json:"price"`
+	BillingPeriod string    `json:"billing_period"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PriceChange is a new price for a subscription that takes effect on
+// EffectiveDate. Once applied, PreviousPrice is the price it replaced, so
+// that charges before EffectiveDate keep their price.
+type PriceChange struct {
+	ID             string     `json:"id"`
+	SubscriptionID string     `json:"subscription_id"`
+	Price          Money      `json:"price"`
+	PreviousPrice  *Money     `json:"previous_price,omitempty"`
+	EffectiveDate  Date       `json:"effective_date"`
+	AppliedAt      *time.Time `json:"applied_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Reprice is the request and result of re-pricing every subscription on a
+// plan.
+type Reprice struct {
+	Price         Money `json:"price"`
+	EffectiveDate Date  `json:"effective_date"`
+	Scheduled     int   `json:"scheduled"`
+	Applied       int   `json:"applied"`
+}
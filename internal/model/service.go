@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Service is an entry of the service catalog. Subscriptions whose
+// service_name matches Name or one of Aliases are linked to it.
+type Service struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	Category  string    `json:"category,omitempty"`
+	VendorURL string    `json:"vendor_url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// User owns subscriptions. Timezone is an IANA zone name and Currency an
+// ISO 4217 code, used as the defaults for the user's data.
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty" example:"user@example.com"`
+	Timezone  string    `json:"timezone" example:"Europe/Moscow"`
+	Currency  string    `json:"currency" example:"RUB"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserSummary is an overview of a user's subscriptions. MonthlySpend is the
+// user's share of the charges due in the current month and NextCharges the
+// next charges of the subscriptions they pay for.
+type UserSummary struct {
+	UserID       string        `json:"user_id"`
+	ActiveCount  int           `json:"active_count"`
+	MonthlySpend Money         `json:"monthly_spend"`
+	NextCharges  []ChargeEvent `json:"next_charges"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Events delivered to webhooks.
+const (
+	EventSubscriptionCreated = "subscription.created"
+	EventSubscriptionUpdated = "subscription.updated"
+	EventSubscriptionDeleted = "subscription.deleted"
+	EventSubscriptionCharged = "subscription.charged"
+	EventBudgetThreshold     = "budget.threshold_reached"
+)
+
+// Events lists every event a webhook can subscribe to.
+var Events = []string{EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionDeleted,
+	EventSubscriptionCharged, EventBudgetThreshold}
+
+// Delivery statuses. A failed delivery is retried until it is delivered or
+// runs out of attempts and becomes dead.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url" example:"https://example.com/hooks/subscriptions"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events" example:"subscription.created,subscription.charged"`
+	OrgID     string    `json:"org_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Event is a change recorded in the outbox together with the change itself.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// Delivery is one event sent, or to be sent, to one webhook.
+type Delivery struct {
+	ID            string     `json:"id"`
+	WebhookID     string     `json:"webhook_id"`
+	Event         Event      `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	ResponseCode  int        `json:"response_code,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,159 @@
+// Package notify delivers reminders about subscriptions through pluggable
+// channels.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Elmar006/subscription_service/internal/config"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// Reminder kinds.
+const (
+	KindCharge   = "charge"
+	KindTrialEnd = "trial_end"
+	KindEnd      = "end"
+)
+
+// Reminder announces an upcoming event of a subscription.
+type Reminder struct {
+	Kind           string      `json:"kind"`
+	SubscriptionID string      `json:"subscription_id"`
+	UserID         string      `json:"user_id"`
+	ServiceName    string      `json:"service_name"`
+	Date           string      `json:"date"`
+	Amount         model.Money `json:"amount,omitzero"`
+}
+
+// Subject returns a one-line human readable summary of r.
+func (r Reminder) Subject() string {
+	switch r.Kind {
+	case KindCharge:
+		return fmt.Sprintf("%s charges %s %s on %s", r.ServiceName, r.Amount, r.Amount.Currency, r.Date)
+	case KindTrialEnd:
+		return fmt.Sprintf("%s trial ends on %s, then it costs %s %s", r.ServiceName, r.Date, r.Amount, r.Amount.Currency)
+	case KindEnd:
+		return fmt.Sprintf("%s subscription ends on %s", r.ServiceName, r.Date)
+	}
+	return fmt.Sprintf("%s: %s on %s", r.ServiceName, r.Kind, r.Date)
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, r Reminder) error
+}
+
+// New builds the notifiers named in cfg.Notifiers, combined into one.
+func New(cfg config.RemindersConfig) (Notifier, error) {
+	var all multi
+	for _, name := range cfg.Notifiers {
+		switch name {
+		case "log":
+			all = append(all, Log{})
+		case "smtp":
+			all = append(all, NewSMTP(cfg.SMTP))
+		case "webhook":
+			all = append(all, NewWebhook(cfg.WebhookURL))
+		default:
+			return nil, fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+	return all, nil
+}
+
+type multi []Notifier
+
+// Notify sends r through every notifier and joins their errors.
+func (m multi) Notify(ctx context.Context, r Reminder) error {
+	var errs []error
+	for _, n := range m {
+		errs = append(errs, n.Notify(ctx, r))
+	}
+	return errors.Join(errs...)
+}
+
+// Log writes reminders to the service log.
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, r Reminder) error {
+	logger.FromContext(ctx).WithFields(log.Fields{
+		"subscription_id": r.SubscriptionID,
+		"user_id":         r.UserID,
+		"kind":            r.Kind,
+	}).Info(r.Subject())
+	return nil
+}
+
+// SMTP mails reminders to a fixed recipient.
+type SMTP struct {
+	cfg config.SMTPConfig
+}
+
+func NewSMTP(cfg config.SMTPConfig) *SMTP {
+	return &SMTP{cfg: cfg}
+}
+
+func (s *SMTP) Notify(ctx context.Context, r Reminder) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", s.cfg.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", r.Subject())
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nSubscription: %s\r\nUser: %s\r\n", r.Subject(), r.SubscriptionID, r.UserID)
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := net.JoinHostPort(s.cfg.Host, s.cfg.Port)
+	if err := smtp.SendMail(addr, auth, s.cfg.From, strings.Split(s.cfg.To, ","), msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// Webhook posts reminders as JSON to a URL.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (h *Webhook) Notify(ctx context.Context, r Reminder) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Elmar006/subscription_service/internal/config"
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+var testReminder = Reminder{
+	Kind:           KindCharge,
+	SubscriptionID: "4658b3ad-0323-4d4d-854c-05da025bf9ef",
+	UserID:         "60601fee-2bf1-4721-ae6f-7636e79a0cba",
+	ServiceName:    "Yandex Plus",
+	Date:           "2026-03-01",
+	Amount:         model.Money{Amount: 39900, Currency: "RUB"},
+}
+
+// smtpStub accepts one SMTP session on a local port and sends the message
+// data it received to the returned channel.
+func smtpStub(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 stub ready")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 stub")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var msg strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					msg.WriteString(l)
+				}
+				data <- msg.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), data
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, data := smtpStub(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	n := NewSMTP(config.SMTPConfig{Host: host, Port: port, From: "billing@example.com", To: "finance@example.com"})
+	if err := n.Notify(context.Background(), testReminder); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	msg := <-data
+	if !strings.Contains(msg, "Subject: Yandex Plus charges 399.00 RUB on 2026-03-01") || !strings.Contains(msg, testReminder.SubscriptionID) {
+		t.Errorf("Unexpected message:\n%s", msg)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Reminder
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL).Notify(context.Background(), testReminder); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if got != testReminder {
+		t.Errorf("Expected %+v, got %+v", testReminder, got)
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL).Notify(context.Background(), testReminder); err == nil {
+		t.Error("Expected an error for a 502 response")
+	}
+}
@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionList   Action = "list"
+	ActionTotal  Action = "total"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	ActionExport Action = "export"
+	ActionPurge  Action = "purge"
+
+	// anyAction matches every action in a rule such as "*:all".
+	anyAction Action = "*"
+)
+
+var knownActions = map[Action]bool{
+	ActionRead: true, ActionList: true, ActionTotal: true, ActionCreate: true,
+	ActionUpdate: true, ActionDelete: true, ActionExport: true, ActionPurge: true,
+	anyAction: true,
+}
+
+const (
+	ScopeOwn = "own"
+	ScopeAll = "all"
+)
+
+// Policy maps role names to the actions they may perform on subscriptions,
+// either only on the caller's own subscriptions or on all of them.
+type Policy struct {
+	roles map[string]map[Action]string
+}
+
+// Default returns the rules used when the configuration declares none.
+func Default() map[string][]string {
+	return map[string][]string{
+		"viewer":  {"read:own", "list:own", "total:own"},
+		"editor":  {"read:own", "list:own", "total:own", "create:own", "update:own"},
+		"finance": {"read:all", "list:all", "total:all", "export:all"},
+		"admin":   {"*:all"},
+	}
+}
+
+// New parses rules of the form "action:scope" per role, for example
+// "update:own" or "*:all", and reports every malformed rule at once.
+func New(rules map[string][]string) (*Policy, error) {
+	p := &Policy{roles: map[string]map[Action]string{}}
+	var errs []error
+
+	for role, list := range rules {
+		actions := map[Action]string{}
+		for _, rule := range list {
+			name, scope, ok := strings.Cut(rule, ":")
+			action := Action(name)
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("role %s: rule %q must be action:scope", role, rule))
+			case !knownActions[action]:
+				errs = append(errs, fmt.Errorf("role %s: unknown action %q", role, name))
+			case scope != ScopeOwn && scope != ScopeAll:
+				errs = append(errs, fmt.Errorf("role %s: unknown scope %q", role, scope))
+			default:
+				if actions[action] != ScopeAll {
+					actions[action] = scope
+				}
+			}
+		}
+		p.roles[role] = actions
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check reports whether any of roles may perform action, and whether the
+// permission extends to other users' subscriptions (all) or only to the
+// caller's own.
+func (p *Policy) Check(roles []string, action Action) (allowed bool, all bool) {
+	for _, role := range roles {
+		actions := p.roles[role]
+		for _, a := range []Action{action, anyAction} {
+			switch actions[a] {
+			case ScopeAll:
+				return true, true
+			case ScopeOwn:
+				allowed = true
+			}
+		}
+	}
+	return allowed, false
+}
+
+// Roles returns the configured role names in sorted order.
+func (p *Policy) Roles() []string {
+	names := make([]string, 0, len(p.roles))
+	for name := range p.roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	p, err := New(Default())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		roles   []string
+		action  Action
+		allowed bool
+		all     bool
+	}{
+		{[]string{"viewer"}, ActionList, true, false},
+		{[]string{"viewer"}, ActionTotal, true, false},
+		{[]string{"viewer"}, ActionCreate, false, false},
+		{[]string{"editor"}, ActionCreate, true, false},
+		{[]string{"editor"}, ActionUpdate, true, false},
+		{[]string{"editor"}, ActionDelete, false, false},
+		{[]string{"finance"}, ActionList, true, true},
+		{[]string{"finance"}, ActionExport, true, true},
+		{[]string{"finance"}, ActionUpdate, false, false},
+		{[]string{"admin"}, ActionDelete, true, true},
+		{[]string{"admin"}, ActionPurge, true, true},
+		{[]string{"editor", "finance"}, ActionRead, true, true},
+		{[]string{"unknown"}, ActionRead, false, false},
+		{nil, ActionRead, false, false},
+	}
+
+	for _, tt := range tests {
+		allowed, all := p.Check(tt.roles, tt.action)
+		if allowed != tt.allowed || all != tt.all {
+			t.Errorf("%v %s: expected (%v, %v), got (%v, %v)", tt.roles, tt.action, tt.allowed, tt.all, allowed, all)
+		}
+	}
+}
+
+func TestNewReportsAllErrors(t *testing.T) {
+	_, err := New(map[string][]string{
+		"broken": {"read", "fly:own", "list:everyone"},
+	})
+	if err == nil {
+		t.Fatal("Expected error for malformed rules")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{`"read"`, `"fly"`, `"everyone"`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected error to mention %s, got: %v", want, msg)
+		}
+	}
+}
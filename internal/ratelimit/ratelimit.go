@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/Elmar006/subscription_service/internal/auth"
+)
+
+// idleTTL is how long a client's bucket is kept after its last request.
+const idleTTL = 10 * time.Minute
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter is a token bucket rate limiter with one bucket per client. A
+// client is identified by its API key, else by its user ID, else by IP, or
+// only by IP for a limiter made with NewByIP.
+type Limiter struct {
+	limit rate.Limit
+	burst int
+	key   func(*http.Request) string
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New returns a limiter that refills perMinute tokens per minute up to burst.
+func New(perMinute, burst int) *Limiter {
+	return &Limiter{
+		limit:     rate.Limit(float64(perMinute) / 60),
+		burst:     burst,
+		key:       clientKey,
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// NewByIP is New with one bucket per client IP. It runs before
+// authentication, so that requests with invalid credentials are limited
+// too.
+func NewByIP(perMinute, burst int) *Limiter {
+	l := New(perMinute, burst)
+	l.key = ipKey
+	return l
+}
+
+// Middleware rejects requests over the limit with 429 and reports the state
+// of the client's bucket in RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, unless an earlier limiter already reported a
+// bucket with fewer requests remaining. Unless made with NewByIP, it must run after
+// authentication so that requests are keyed by caller rather than by IP.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		lim := l.bucketFor(l.key(r), now)
+
+		allowed := lim.AllowN(now, 1)
+		tokens := lim.TokensAt(now)
+
+		// Several limiters may run for one request; the headers describe
+		// the bucket closest to rejecting it.
+		h := w.Header()
+		remaining := max(0, int(math.Floor(tokens)))
+		if prev, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err != nil || !allowed || remaining < prev {
+			h.Set("RateLimit-Limit", strconv.Itoa(l.burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(l.secondsUntil(float64(l.burst)-tokens)))
+		}
+
+		if !allowed {
+			h.Set("Retry-After", strconv.Itoa(max(1, l.secondsUntil(1-tokens))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// secondsUntil returns how many seconds it takes to refill n tokens.
+func (l *Limiter) secondsUntil(n float64) int {
+	if n <= 0 || l.limit <= 0 {
+		return 0
+	}
+	return int(math.Ceil(n / float64(l.limit)))
+}
+
+func (l *Limiter) bucketFor(key string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > idleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
+
+func clientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		if p.KeyID != "" {
+			return "key:" + p.KeyID
+		}
+		if p.UserID != "" {
+			return "user:" + p.UserID
+		}
+	}
+	return ipKey(r)
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
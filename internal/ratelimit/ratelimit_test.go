@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Elmar006/subscription_service/internal/auth"
+)
+
+func TestMiddleware(t *testing.T) {
+	l := New(60, 2)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(keyID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/subscriptions/total", nil)
+		req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{KeyID: keyID}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := send("a"); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, w.Code)
+		}
+	}
+
+	w := send("a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 after burst, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected headers %v", w.Header())
+	}
+
+	if w := send("b"); w.Code != http.StatusOK {
+		t.Errorf("Expected a separate bucket for another key, got %d", w.Code)
+	}
+}
+
+func TestMiddlewareByIP(t *testing.T) {
+	l := NewByIP(60, 1)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(keyID, addr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/subscriptions", nil)
+		req.RemoteAddr = addr
+		req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{KeyID: keyID}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("a", "192.0.2.1:1234"); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if code := send("b", "192.0.2.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected another key from the same IP to share its bucket, got %d", code)
+	}
+	if code := send("a", "192.0.2.2:1234"); code != http.StatusOK {
+		t.Errorf("Expected a separate bucket for another IP, got %d", code)
+	}
+}
+
+func TestMiddlewareReportsTightestBucket(t *testing.T) {
+	loose, tight := New(600, 60), New(60, 3)
+	inner := loose.Middleware(tight.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	outer := tight.Middleware(loose.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	for _, handler := range []http.Handler{inner, outer} {
+		req := httptest.NewRequest(http.MethodGet, "/subscriptions", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Header().Get("RateLimit-Limit") != "3" {
+			t.Errorf("Expected the headers of the tighter bucket, got %v", w.Header())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Package reminder finds subscription events coming up within a few days
+// and announces each of them once through a notifier.
+package reminder
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/notify"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/zone"
+)
+
+const dateLayout = "2006-01-02"
+
+type Reminder struct {
+	subs       repository.SubscriptionRepository
+	sent       repository.ReminderRepository
+	zones      *zone.Resolver
+	notifier   notify.Notifier
+	daysBefore int
+}
+
+func New(subs repository.SubscriptionRepository, sent repository.ReminderRepository, zones *zone.Resolver,
+	notifier notify.Notifier, daysBefore int) *Reminder {
+	return &Reminder{subs: subs, sent: sent, zones: zones, notifier: notifier, daysBefore: daysBefore}
+}
+
+// Due returns the reminders for events of subs between from and to: paid
+// charges, trial ends and end dates. A charge on the trial end date is
+// announced as the trial end.
+func Due(subs []*model.Subscription, from, to time.Time) []notify.Reminder {
+	var out []notify.Reminder
+	for _, sub := range subs {
+		if sub.Status == model.StatusPaused {
+			continue
+		}
+		base := notify.Reminder{SubscriptionID: sub.ID, UserID: sub.UserID, ServiceName: sub.ServiceName}
+		trialEnd, trialErr := sub.TrialEndDate.Last()
+		end, endErr := sub.EndDate.Last()
+
+		for _, c := range billing.Charges(sub, from, to) {
+			if trialErr == nil && c.Date.Equal(trialEnd) {
+				continue
+			}
+			r := base
+			r.Kind, r.Date, r.Amount = notify.KindCharge, c.Date.Format(dateLayout), c.Amount
+			out = append(out, r)
+		}
+
+		if trialErr == nil && inWindow(trialEnd, from, to) && (endErr != nil || !end.Before(trialEnd)) {
+			r := base
+			r.Kind, r.Date, r.Amount = notify.KindTrialEnd, trialEnd.Format(dateLayout), billing.AmountAt(sub, trialEnd)
+			out = append(out, r)
+		}
+
+		if endErr == nil && inWindow(end, from, to) {
+			r := base
+			r.Kind, r.Date = notify.KindEnd, end.Format(dateLayout)
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Run sends the reminders for events from today up to daysBefore days
+// ahead that have not been sent yet, today being the date of now in the
+// zone of each subscription's user.
+func (rm *Reminder) Run(ctx context.Context, now time.Time) error {
+	// Every zone is less than a day away from UTC, so one more day on each
+	// side covers the window of every user.
+	utc := zone.Today(now, time.UTC)
+	from, to := utc.AddDate(0, 0, -1), utc.AddDate(0, 0, rm.daysBefore+1)
+	subs, err := rm.subs.ListBetween(ctx, nil, nil, from, to)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	zones := map[string]*time.Location{}
+	for _, r := range Due(subs, from, to) {
+		loc, ok := zones[r.UserID]
+		if !ok {
+			loc = time.UTC
+			if rm.zones != nil {
+				if loc, err = rm.zones.Location(ctx, r.UserID); err != nil {
+					return err
+				}
+			}
+			zones[r.UserID] = loc
+		}
+		today := zone.Today(now, loc)
+		due, _ := time.Parse(dateLayout, r.Date)
+		if !inWindow(due, today, today.AddDate(0, 0, rm.daysBefore)) {
+			continue
+		}
+
+		fresh, err := rm.sent.MarkSent(ctx, r.SubscriptionID, r.Kind, due)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			continue
+		}
+		if err := rm.notifier.Notify(ctx, r); err != nil {
+			errs = append(errs, err)
+			if err := rm.sent.Unmark(ctx, r.SubscriptionID, r.Kind, due); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Job adapts Run to the scheduler, using the current time.
+func (rm *Reminder) Job(ctx context.Context) error {
+	return rm.Run(ctx, time.Now())
+}
+
+func inWindow(t, from, to time.Time) bool {
+	return !t.Before(from) && !t.After(to)
+}
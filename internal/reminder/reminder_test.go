@@ -0,0 +1,43 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/notify"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse(dateLayout, s)
+	return t
+}
+
+func rub(amount int64) model.Money {
+	return model.Money{Amount: amount, Currency: "RUB"}
+}
+
+func TestDue(t *testing.T) {
+	subs := []*model.Subscription{
+		{ID: "charge", ServiceName: "Music", Price: rub(100), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-05", Status: model.StatusActive},
+		{ID: "trial", ServiceName: "Video", Price: rub(300), BillingPeriod: model.BillingMonthly, StartDate: "2026-02-20", TrialEndDate: "2026-03-06", Status: model.StatusTrial},
+		{ID: "end", ServiceName: "Cloud", Price: rub(50), BillingPeriod: model.BillingYearly, StartDate: "2025-06-01", EndDate: "2026-03-04", Status: model.StatusCancelled},
+		{ID: "paused", ServiceName: "News", Price: rub(10), BillingPeriod: model.BillingMonthly, StartDate: "2026-01-05", Status: model.StatusPaused},
+	}
+
+	got := Due(subs, date("2026-03-03"), date("2026-03-06"))
+	want := []notify.Reminder{
+		{Kind: notify.KindCharge, SubscriptionID: "charge", ServiceName: "Music", Date: "2026-03-05", Amount: rub(100)},
+		{Kind: notify.KindTrialEnd, SubscriptionID: "trial", ServiceName: "Video", Date: "2026-03-06", Amount: rub(300)},
+		{Kind: notify.KindEnd, SubscriptionID: "end", ServiceName: "Cloud", Date: "2026-03-04"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d reminders, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Reminder %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetActiveByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	List(ctx context.Context) ([]*model.APIKey, error)
+	Revoke(ctx context.Context, id string) (bool, error)
+}
+
+type apiKeyRepo struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepo(db *sql.DB) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+func (s *apiKeyRepo) Create(ctx context.Context, key *model.APIKey) (err error) {
+	const query = `INSERT INTO api_keys (id, name, prefix, key_hash, scopes, expires_at, created_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)`
+	ctx, end := startCall(ctx, "APIKeyRepository", "Create", query)
+	defer end(&err)
+
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+
+	_, err = s.db.ExecContext(ctx, query,
+		key.ID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt, key.CreatedAt,
+	)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting api key: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetActiveByHash returns the key with the given hash unless it has been
+// revoked. Expiry is left to the caller so it can report it separately.
+func (s *apiKeyRepo) GetActiveByHash(ctx context.Context, hash string) (_ *model.APIKey, err error) {
+	const query = `SELECT id, name, prefix, key_hash, scopes, expires_at, revoked_at, created_at
+		 FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`
+	ctx, end := startCall(ctx, "APIKeyRepository", "GetActiveByHash", query)
+	defer end(&err)
+
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching api key: %v", err)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (s *apiKeyRepo) List(ctx context.Context) (_ []*model.APIKey, err error) {
+	const query = `SELECT id, name, prefix, key_hash, scopes, expires_at, revoked_at, created_at
+		 FROM api_keys ORDER BY created_at`
+	ctx, end := startCall(ctx, "APIKeyRepository", "List", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing api keys: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*model.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	setRows(ctx, len(keys))
+
+	return keys, rows.Err()
+}
+
+// Revoke marks the key as revoked and reports whether an active key with
+// that ID existed.
+func (s *apiKeyRepo) Revoke(ctx context.Context, id string) (_ bool, err error) {
+	const query = `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	ctx, end := startCall(ctx, "APIKeyRepository", "Revoke", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error revoking api key: %v", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	setRows(ctx, int(n))
+
+	return n > 0, nil
+}
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	var expiresAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes), &expiresAt, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// BudgetRepository stores budgets. Like SubscriptionRepository it only sees
+// the organization's budgets when the context is scoped to one.
+type BudgetRepository interface {
+	Create(ctx context.Context, b *model.Budget) error
+	GetByID(ctx context.Context, id string) (*model.Budget, error)
+	List(ctx context.Context, userID *string) ([]*model.Budget, error)
+	Update(ctx context.Context, b *model.Budget) (bool, error)
+	Delete(ctx context.Context, id string) (bool, error)
+	ForSubscription(ctx context.Context, sub *model.Subscription) ([]*model.Budget, error)
+	Subscriptions(ctx context.Context, b *model.Budget, from, to time.Time) ([]*model.Subscription, error)
+}
+
+type budgetRepo struct {
+	db   *sql.DB
+	subs *subscriptionRepo
+}
+
+func NewBudgetRepo(db *sql.DB) BudgetRepository {
+	return &budgetRepo{db: db, subs: &subscriptionRepo{db: db}}
+}
+
+const budgetColumns = `id, user_id, org_id, service_name, category, amount, currency, created_at`
+
+func scanBudget(row rowScanner) (*model.Budget, error) {
+	b := &model.Budget{}
+	var userID, orgID, serviceName, category sql.NullString
+	if err := row.Scan(&b.ID, &userID, &orgID, &serviceName, &category, &b.Amount.Amount, &b.Amount.Currency, &b.CreatedAt); err != nil {
+		return nil, err
+	}
+	b.UserID = userID.String
+	b.OrgID = orgID.String
+	b.ServiceName = serviceName.String
+	b.Category = category.String
+	return b, nil
+}
+
+func (s *budgetRepo) Create(ctx context.Context, b *model.Budget) (err error) {
+	const query = `INSERT INTO budgets (id, user_id, org_id, service_name, category, amount, currency, created_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
+	ctx, end := startCall(ctx, "BudgetRepository", "Create", query)
+	defer end(&err)
+
+	if b.ID == "" {
+		b.ID = uuid.New().String()
+	}
+	if orgID := tenant.OrgID(ctx); orgID != "" {
+		b.OrgID = orgID
+	}
+
+	_, err = s.db.ExecContext(ctx, query, b.ID, nullString(b.UserID), nullString(b.OrgID),
+		nullString(b.ServiceName), nullString(b.Category), b.Amount.Amount, b.Amount.Currency, b.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting budget: %v", err)
+		return userError(err)
+	}
+	return nil
+}
+
+func (s *budgetRepo) GetByID(ctx context.Context, id string) (_ *model.Budget, err error) {
+	query, args := scopeToOrg(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE id = $1`, []any{id})
+	ctx, end := startCall(ctx, "BudgetRepository", "GetByID", query)
+	defer end(&err)
+
+	b, err := scanBudget(s.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching budget: %v", err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// List returns the budgets, optionally only those of one user, oldest
+// first.
+func (s *budgetRepo) List(ctx context.Context, userID *string) (_ []*model.Budget, err error) {
+	query := `SELECT ` + budgetColumns + ` FROM budgets WHERE TRUE`
+	var args []any
+	if userID != nil {
+		args = append(args, *userID)
+		query += " AND user_id = $1"
+	}
+	query, args = scopeToOrg(ctx, query, args)
+	query += " ORDER BY created_at"
+	ctx, end := startCall(ctx, "BudgetRepository", "List", query)
+	defer end(&err)
+
+	return s.query(ctx, query, args)
+}
+
+func (s *budgetRepo) query(ctx context.Context, query string, args []any) ([]*model.Budget, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing budgets: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var budgets []*model.Budget
+	for rows.Next() {
+		b, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	setRows(ctx, len(budgets))
+
+	return budgets, nil
+}
+
+// Update changes the limit and filters of a budget and reports whether it
+// exists. The owner of a budget never changes.
+func (s *budgetRepo) Update(ctx context.Context, b *model.Budget) (_ bool, err error) {
+	query, args := scopeToOrg(ctx, `UPDATE budgets SET service_name=$1, category=$2, amount=$3, currency=$4 WHERE id=$5`,
+		[]any{nullString(b.ServiceName), nullString(b.Category), b.Amount.Amount, b.Amount.Currency, b.ID})
+	ctx, end := startCall(ctx, "BudgetRepository", "Update", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error updating budget: %v", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *budgetRepo) Delete(ctx context.Context, id string) (_ bool, err error) {
+	query, args := scopeToOrg(ctx, `DELETE FROM budgets WHERE id=$1`, []any{id})
+	ctx, end := startCall(ctx, "BudgetRepository", "Delete", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error deleting budget: %v", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ForSubscription returns the budgets that sub counts towards: those of its
+// user, of its members and of its organization that are overall or match
+// its service or its category, in the currency of sub.
+func (s *budgetRepo) ForSubscription(ctx context.Context, sub *model.Subscription) (_ []*model.Budget, err error) {
+	query := `SELECT ` + budgetColumns + ` FROM budgets
+		 WHERE ((user_id = ANY($1) AND (org_id IS NULL OR org_id = $2)) OR (user_id IS NULL AND org_id = $2))
+		 AND (service_name IS NULL OR service_name = $3
+		      OR EXISTS (SELECT 1 FROM services WHERE id = $4 AND (` + serviceMatch("budgets.service_name") + `)))
+		 AND (category IS NULL OR lower(category) = $5) AND currency = $6`
+	ctx, end := startCall(ctx, "BudgetRepository", "ForSubscription", query)
+	defer end(&err)
+
+	users := []string{sub.UserID}
+	for _, m := range sub.Members {
+		users = append(users, m.UserID)
+	}
+	return s.query(ctx, query, []any{pq.Array(users), nullString(sub.OrgID), sub.ServiceName, nullString(sub.ServiceID), NormalizeLabel(sub.Category), sub.Price.Currency})
+}
+
+// Subscriptions returns the subscriptions counting towards b that run at
+// some point between from and to: for a user's budget those the user pays
+// for or is a member of, like ListInvolving. Only subscriptions in the
+// currency of the budget count towards it.
+func (s *budgetRepo) Subscriptions(ctx context.Context, b *model.Budget, from, to time.Time) ([]*model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions
+		 WHERE start_date <= $1 AND (end_date IS NULL OR end_date >= $2) AND currency = $3`
+	args := []any{to, from, b.Amount.Currency}
+
+	if b.UserID != "" {
+		args = append(args, b.UserID)
+		query += " AND " + involving("$"+strconv.Itoa(len(args)))
+	}
+	if b.OrgID != "" {
+		args = append(args, b.OrgID)
+		query += " AND org_id = $" + strconv.Itoa(len(args))
+	}
+	if b.ServiceName != "" {
+		query, args = serviceFilter(query, args, b.ServiceName)
+	}
+	if b.Category != "" {
+		args = append(args, NormalizeLabel(b.Category))
+		query += " AND category = $" + strconv.Itoa(len(args))
+	}
+
+	return s.subs.list(ctx, "Budget.Subscriptions", query, args)
+}
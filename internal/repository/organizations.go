@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+type OrganizationRepository interface {
+	Create(ctx context.Context, org *model.Organization) error
+	GetByID(ctx context.Context, id string) (*model.Organization, error)
+	List(ctx context.Context) ([]*model.Organization, error)
+	AddMember(ctx context.Context, member *model.OrgMember) error
+	RemoveMember(ctx context.Context, orgID, userID string) (bool, error)
+	ListMembers(ctx context.Context, orgID string) ([]*model.OrgMember, error)
+	MembershipsOf(ctx context.Context, userID string) ([]*model.OrgMember, error)
+	Total(ctx context.Context, orgID string, serviceName *string, from, to time.Time) (*model.OrgTotal, error)
+}
+
+type organizationRepo struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepo(db *sql.DB) OrganizationRepository {
+	return &organizationRepo{db: db}
+}
+
+func (s *organizationRepo) Create(ctx context.Context, org *model.Organization) (err error) {
+	const query = `INSERT INTO organizations (id, name, timezone, created_at) VALUES ($1,$2,$3,$4)`
+	ctx, end := startCall(ctx, "OrganizationRepository", "Create", query)
+	defer end(&err)
+
+	if org.ID == "" {
+		org.ID = uuid.New().String()
+	}
+
+	_, err = s.db.ExecContext(ctx, query, org.ID, org.Name, org.Timezone, org.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting organization: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *organizationRepo) GetByID(ctx context.Context, id string) (_ *model.Organization, err error) {
+	const query = `SELECT id, name, timezone, created_at FROM organizations WHERE id = $1`
+	ctx, end := startCall(ctx, "OrganizationRepository", "GetByID", query)
+	defer end(&err)
+
+	org := &model.Organization{}
+	err = s.db.QueryRowContext(ctx, query, id).Scan(&org.ID, &org.Name, &org.Timezone, &org.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching organization: %v", err)
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (s *organizationRepo) List(ctx context.Context) (_ []*model.Organization, err error) {
+	const query = `SELECT id, name, timezone, created_at FROM organizations ORDER BY name`
+	ctx, end := startCall(ctx, "OrganizationRepository", "List", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing organizations: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*model.Organization
+	for rows.Next() {
+		org := &model.Organization{}
+		if err := rows.Scan(&org.ID, &org.Name, &org.Timezone, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	setRows(ctx, len(orgs))
+
+	return orgs, rows.Err()
+}
+
+// AddMember adds a user to an organization or changes the role of an
+// existing member.
+func (s *organizationRepo) AddMember(ctx context.Context, member *model.OrgMember) (err error) {
+	const query = `INSERT INTO org_members (org_id, user_id, role, created_at) VALUES ($1,$2,$3,$4)
+		 ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role`
+	ctx, end := startCall(ctx, "OrganizationRepository", "AddMember", query)
+	defer end(&err)
+
+	_, err = s.db.ExecContext(ctx, query, member.OrgID, member.UserID, member.Role, member.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error adding organization member: %v", err)
+		return userError(err)
+	}
+
+	return nil
+}
+
+func (s *organizationRepo) RemoveMember(ctx context.Context, orgID, userID string) (_ bool, err error) {
+	const query = `DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`
+	ctx, end := startCall(ctx, "OrganizationRepository", "RemoveMember", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error removing organization member: %v", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *organizationRepo) ListMembers(ctx context.Context, orgID string) ([]*model.OrgMember, error) {
+	return s.listMembers(ctx, "ListMembers",
+		`SELECT org_id, user_id, role, created_at FROM org_members WHERE org_id = $1 ORDER BY created_at`, orgID)
+}
+
+func (s *organizationRepo) MembershipsOf(ctx context.Context, userID string) ([]*model.OrgMember, error) {
+	return s.listMembers(ctx, "MembershipsOf",
+		`SELECT org_id, user_id, role, created_at FROM org_members WHERE user_id = $1 ORDER BY created_at`, userID)
+}
+
+func (s *organizationRepo) listMembers(ctx context.Context, method, query string, arg string) (_ []*model.OrgMember, err error) {
+	ctx, end := startCall(ctx, "OrganizationRepository", method, query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing organization members: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*model.OrgMember
+	for rows.Next() {
+		m := &model.OrgMember{}
+		if err := rows.Scan(&m.OrgID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	setRows(ctx, len(members))
+
+	return members, rows.Err()
+}
+
+// Total sums the organization's subscriptions with the same rules as
+// SubscriptionRepository.Total and breaks the result down per user.
+// Subscriptions in different currencies give model.ErrMixedCurrencies.
+func (s *organizationRepo) Total(ctx context.Context, orgID string, serviceName *string, from, to time.Time) (_ *model.OrgTotal, err error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions
+		 WHERE org_id = $1 AND start_date <= $2 AND (end_date IS NULL OR end_date >= $3)`
+	args := []any{orgID, to, from}
+	if serviceName != nil {
+		query, args = serviceFilter(query, args, *serviceName)
+	}
+	query += " ORDER BY user_id"
+
+	ctx, end := startCall(ctx, "OrganizationRepository", "Total", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error calculating organization total: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	day := today(ctx)
+	var subs []*model.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows, day)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := loadHistory(ctx, s.db, subs); err != nil {
+		return nil, err
+	}
+
+	// An organization has no currency of its own to report an empty total in.
+	currency, err := billing.Currency(subs)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		currency = model.DefaultCurrency
+	}
+	result := &model.OrgTotal{OrgID: orgID, Total: model.Money{Currency: currency}, Members: []model.MemberTotal{}}
+	for _, sub := range subs {
+		amount, err := billing.Total([]*model.Subscription{sub}, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(result.Members); n == 0 || result.Members[n-1].UserID != sub.UserID {
+			result.Members = append(result.Members, model.MemberTotal{UserID: sub.UserID})
+		}
+		m := &result.Members[len(result.Members)-1]
+		m.Total = m.Total.Add(amount)
+		result.Total = result.Total.Add(amount)
+	}
+
+	return result, nil
+}
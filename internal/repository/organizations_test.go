@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+	"github.com/google/uuid"
+)
+
+func createTestOrg(t *testing.T, orgs OrganizationRepository) *model.Organization {
+	org := &model.Organization{Name: "Org " + uuid.New().String(), CreatedAt: time.Now()}
+	if err := orgs.Create(context.Background(), org); err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	return org
+}
+
+func TestTenantScoping(t *testing.T) {
+	orgs := NewOrganizationRepo(testDB)
+	orgA := createTestOrg(t, orgs)
+	orgB := createTestOrg(t, orgs)
+
+	ctxA := tenant.WithOrg(context.Background(), orgA.ID)
+	sub := &model.Subscription{
+		ServiceName: "Tenant Service",
+		Price:       rub(300),
+		UserID:      createTestUser(t),
+		StartDate:   "2026-01-01",
+		CreatedAt:   time.Now(),
+	}
+	if err := testRepo.Create(ctxA, sub); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if sub.OrgID != orgA.ID {
+		t.Errorf("Expected org_id %s, got %s", orgA.ID, sub.OrgID)
+	}
+
+	check, err := testRepo.GetByID(tenant.WithOrg(context.Background(), orgB.ID), sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if check != nil {
+		t.Errorf("Subscription of another organization must not be visible")
+	}
+}
+
+func TestOrganizationTotal(t *testing.T) {
+	orgs := NewOrganizationRepo(testDB)
+	org := createTestOrg(t, orgs)
+	ctx := tenant.WithOrg(context.Background(), org.ID)
+
+	users := []string{createTestUser(t), createTestUser(t)}
+	for i, userID := range users {
+		sub := &model.Subscription{
+			ServiceName: "Org Service",
+			Price:       rub(int64(100 * (i + 1))),
+			UserID:      userID,
+			StartDate:   "2026-01-01",
+			CreatedAt:   time.Now(),
+		}
+		if err := testRepo.Create(ctx, sub); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	from, _ := time.Parse("2006-01-02", "2026-01-01")
+	to, _ := time.Parse("2006-01-02", "2026-12-31")
+	total, err := orgs.Total(context.Background(), org.ID, nil, from, to)
+	if err != nil {
+		t.Fatalf("Total failed: %v", err)
+	}
+
+	if total.Total != rub(12*300) || len(total.Members) != 2 {
+		t.Errorf("Expected total %s for 2 members, got %+v", rub(12*300), total)
+	}
+}
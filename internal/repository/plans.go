@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// PlanRepository stores the plans of catalog services and the price
+// changes scheduled for subscriptions on them.
+type PlanRepository interface {
+	Create(ctx context.Context, plan *model.Plan) error
+	GetByID(ctx context.Context, id string) (*model.Plan, error)
+	ListByService(ctx context.Context, serviceID string) ([]*model.Plan, error)
+	Update(ctx context.Context, plan *model.Plan) (bool, error)
+	Delete(ctx context.Context, id string) (bool, error)
+	Reprice(ctx context.Context, planID string, price model.Money, effective time.Time) (int, error)
+	ApplyPriceChanges(ctx context.Context, at time.Time) (int, error)
+}
+
+type planRepo struct {
+	db *sql.DB
+}
+
+func NewPlanRepo(db *sql.DB) PlanRepository {
+	return &planRepo{db: db}
+}
+
+const planColumns = `id, service_id, name, price, currency, billing_period, created_at`
+
+func scanPlan(row rowScanner) (*model.Plan, error) {
+	plan := &model.Plan{}
+	err := row.Scan(&plan.ID, &plan.ServiceID, &plan.Name, &plan.Price.Amount, &plan.Price.Currency, &plan.BillingPeriod, &plan.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *planRepo) Create(ctx context.Context, plan *model.Plan) (err error) {
+	const query = `INSERT INTO plans (id, service_id, name, price, currency, billing_period, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7)`
+	ctx, end := startCall(ctx, "PlanRepository", "Create", query)
+	defer end(&err)
+
+	if plan.ID == "" {
+		plan.ID = uuid.New().String()
+	}
+	if plan.BillingPeriod == "" {
+		plan.BillingPeriod = model.BillingMonthly
+	}
+	plan.Name = strings.TrimSpace(plan.Name)
+
+	_, err = s.db.ExecContext(ctx, query, plan.ID, plan.ServiceID, plan.Name, plan.Price.Amount, plan.Price.Currency, plan.BillingPeriod, plan.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting plan: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *planRepo) GetByID(ctx context.Context, id string) (_ *model.Plan, err error) {
+	const query = `SELECT ` + planColumns + ` FROM plans WHERE id = $1`
+	ctx, end := startCall(ctx, "PlanRepository", "GetByID", query)
+	defer end(&err)
+
+	plan, err := scanPlan(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching plan: %v", err)
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func (s *planRepo) ListByService(ctx context.Context, serviceID string) (_ []*model.Plan, err error) {
+	const query = `SELECT ` + planColumns + ` FROM plans WHERE service_id = $1 ORDER BY currency, price, name`
+	ctx, end := startCall(ctx, "PlanRepository", "ListByService", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query, serviceID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing plans: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []*model.Plan{}
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	setRows(ctx, len(plans))
+
+	return plans, rows.Err()
+}
+
+// Update changes the plan's name, default price and billing period. Prices
+// of existing subscriptions are left alone, use Reprice for that.
+func (s *planRepo) Update(ctx context.Context, plan *model.Plan) (_ bool, err error) {
+	const query = `UPDATE plans SET name=$1, price=$2, currency=$3, billing_period=$4 WHERE id=$5`
+	ctx, end := startCall(ctx, "PlanRepository", "Update", query)
+	defer end(&err)
+
+	plan.Name = strings.TrimSpace(plan.Name)
+	res, err := s.db.ExecContext(ctx, query, plan.Name, plan.Price.Amount, plan.Price.Currency, plan.BillingPeriod, plan.ID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error updating plan: %v", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *planRepo) Delete(ctx context.Context, id string) (_ bool, err error) {
+	const query = `DELETE FROM plans WHERE id = $1`
+	ctx, end := startCall(ctx, "PlanRepository", "Delete", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error deleting plan: %v", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Reprice sets the plan's default price and schedules the new price for
+// every subscription on the plan that has not ended before effective and
+// is priced in the currency of price. It returns the number of scheduled
+// changes; changes already due are applied by the next ApplyPriceChanges
+// call.
+func (s *planRepo) Reprice(ctx context.Context, planID string, price model.Money, effective time.Time) (_ int, err error) {
+	const query = `INSERT INTO price_changes (id, subscription_id, price, effective_date, created_at)
+		 SELECT uuid_generate_v4(), id, $2, $3, now() FROM subscriptions
+		 WHERE plan_id = $1 AND (end_date IS NULL OR end_date >= $3) AND currency = $4`
+	ctx, end := startCall(ctx, "PlanRepository", "Reprice", query)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE plans SET price=$1, currency=$2 WHERE id=$3`, price.Amount, price.Currency, planID); err != nil {
+		logger.FromContext(ctx).Errorf("Error updating plan price: %v", err)
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, query, planID, price.Amount, effective, price.Currency)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error scheduling price changes: %v", err)
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	setRows(ctx, int(n))
+
+	return int(n), tx.Commit()
+}
+
+// ApplyPriceChanges copies every pending price change effective on or
+// before at into its subscription and returns how many subscriptions were
+// re-priced. Each applied change keeps the price it replaced, see
+// billing.PriceAt. Re-priced subscriptions are announced in the outbox.
+func (s *planRepo) ApplyPriceChanges(ctx context.Context, at time.Time) (_ int, err error) {
+	const query = `WITH due AS (
+			SELECT pc.id, COALESCE(lag(pc.price) OVER (PARTITION BY pc.subscription_id
+			        ORDER BY pc.effective_date, pc.created_at), s.price) AS previous_price
+			  FROM price_changes pc JOIN subscriptions s ON s.id = pc.subscription_id
+			 WHERE pc.applied_at IS NULL AND pc.effective_date <= $1
+		 ), applied AS (
+			UPDATE price_changes pc SET applied_at = now(), previous_price = due.previous_price
+			  FROM due WHERE pc.id = due.id AND pc.applied_at IS NULL
+			 RETURNING pc.subscription_id, pc.price, pc.effective_date, pc.created_at
+		 ), latest AS (
+			SELECT DISTINCT ON (subscription_id) subscription_id, price AS new_price FROM applied
+			 ORDER BY subscription_id, effective_date DESC, created_at DESC
+		 )
+		 UPDATE subscriptions SET price = latest.new_price FROM latest WHERE subscriptions.id = latest.subscription_id
+		 RETURNING ` + subscriptionColumns
+	ctx, end := startCall(ctx, "PlanRepository", "ApplyPriceChanges", query)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	subs, err := changedRows(ctx, tx, query, []any{at})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error applying price changes: %v", err)
+		return 0, err
+	}
+	if err := loadHistory(ctx, tx, subs); err != nil {
+		return 0, err
+	}
+	if err := enqueueChanged(ctx, tx, model.EventSubscriptionUpdated, subs); err != nil {
+		logger.FromContext(ctx).Errorf("Error writing price change events: %v", err)
+		return 0, err
+	}
+
+	return len(subs), tx.Commit()
+}
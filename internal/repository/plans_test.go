@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+func createTestPlan(t *testing.T, plans PlanRepository, serviceID string) *model.Plan {
+	plan := &model.Plan{ServiceID: serviceID, Name: "Family", Price: rub(500), CreatedAt: time.Now()}
+	if err := plans.Create(context.Background(), plan); err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	return plan
+}
+
+func TestRepricePlan(t *testing.T) {
+	plans := NewPlanRepo(testDB)
+	svc := createTestService(t, NewServiceRepo(testDB))
+	plan := createTestPlan(t, plans, svc.ID)
+
+	active := &model.Subscription{ServiceName: svc.Name, ServiceID: svc.ID, PlanID: plan.ID, Price: rub(500),
+		UserID: createTestUser(t), StartDate: "2026-01-01", CreatedAt: time.Now()}
+	ended := &model.Subscription{ServiceName: svc.Name, ServiceID: svc.ID, PlanID: plan.ID, Price: rub(500),
+		UserID: createTestUser(t), StartDate: "2025-01-01", EndDate: "2025-12-31", CreatedAt: time.Now()}
+	for _, sub := range []*model.Subscription{active, ended} {
+		if err := testRepo.Create(context.Background(), sub); err != nil {
+			t.Fatalf("Failed to create subscription: %v", err)
+		}
+	}
+
+	effective, _ := time.Parse("2006-01-02", "2026-03-01")
+	scheduled, err := plans.Reprice(context.Background(), plan.ID, rub(650), effective)
+	if err != nil {
+		t.Fatalf("Reprice failed: %v", err)
+	}
+	if scheduled != 1 {
+		t.Errorf("Expected 1 scheduled change, got %d", scheduled)
+	}
+
+	before, _ := time.Parse("2006-01-02", "2026-02-28")
+	if _, err := plans.ApplyPriceChanges(context.Background(), before); err != nil {
+		t.Fatalf("ApplyPriceChanges failed: %v", err)
+	}
+	check, _ := testRepo.GetByID(context.Background(), active.ID)
+	if check.Price != rub(500) {
+		t.Errorf("Price changed before the effective date: %s", check.Price)
+	}
+	if len(check.PriceChanges) != 1 || check.PriceChanges[0].EffectiveDate != "2026-03-01" {
+		t.Errorf("Expected the pending price change to be loaded, got %+v", check.PriceChanges)
+	}
+
+	february, _ := time.Parse("2006-01-02", "2026-02-28")
+	january, _ := time.Parse("2006-01-02", "2026-01-01")
+	totalBefore, err := testRepo.Total(context.Background(), &active.UserID, nil, january, february)
+	if err != nil {
+		t.Fatalf("Total failed: %v", err)
+	}
+
+	if _, err := plans.ApplyPriceChanges(context.Background(), effective); err != nil {
+		t.Fatalf("ApplyPriceChanges failed: %v", err)
+	}
+	if n := countEvents(t, model.EventSubscriptionUpdated, active.ID); n != 1 {
+		t.Errorf("Expected 1 update event for the re-priced subscription, got %d", n)
+	}
+	check, _ = testRepo.GetByID(context.Background(), active.ID)
+	if check.Price != rub(650) || len(check.PriceChanges) != 1 || check.PriceChanges[0].AppliedAt == nil ||
+		check.PriceChanges[0].PreviousPrice == nil || *check.PriceChanges[0].PreviousPrice != rub(500) {
+		t.Errorf("Expected price 650 and the applied change replacing 500, got %s, %+v", check.Price, check.PriceChanges)
+	}
+
+	// Charges before the effective date keep the old price.
+	totalAfter, err := testRepo.Total(context.Background(), &active.UserID, nil, january, february)
+	if err != nil {
+		t.Fatalf("Total failed: %v", err)
+	}
+	if totalBefore != rub(1000) || totalAfter != totalBefore {
+		t.Errorf("Expected January and February to stay at 10.00, got %s before and %s after", totalBefore, totalAfter)
+	}
+	check, _ = testRepo.GetByID(context.Background(), ended.ID)
+	if check.Price != rub(500) {
+		t.Errorf("Ended subscription was re-priced to %s", check.Price)
+	}
+
+	updated, _ := plans.GetByID(context.Background(), plan.ID)
+	if updated.Price != rub(650) {
+		t.Errorf("Expected plan price 650, got %s", updated.Price)
+	}
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// ReminderRepository remembers which reminders were sent so that each
+// event is announced once, however often the reminder job runs.
+type ReminderRepository interface {
+	MarkSent(ctx context.Context, subscriptionID, kind string, due time.Time) (bool, error)
+	Unmark(ctx context.Context, subscriptionID, kind string, due time.Time) error
+}
+
+type reminderRepo struct {
+	db *sql.DB
+}
+
+func NewReminderRepo(db *sql.DB) ReminderRepository {
+	return &reminderRepo{db: db}
+}
+
+// MarkSent records the reminder and reports false when it had already been
+// recorded.
+func (s *reminderRepo) MarkSent(ctx context.Context, subscriptionID, kind string, due time.Time) (_ bool, err error) {
+	const query = `INSERT INTO reminders_sent (subscription_id, kind, due_date) VALUES ($1,$2,$3)
+		 ON CONFLICT DO NOTHING`
+	ctx, end := startCall(ctx, "ReminderRepository", "MarkSent", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, subscriptionID, kind, due)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error recording reminder: %v", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Unmark forgets a reminder whose delivery failed so that the next run
+// retries it.
+func (s *reminderRepo) Unmark(ctx context.Context, subscriptionID, kind string, due time.Time) (err error) {
+	const query = `DELETE FROM reminders_sent WHERE subscription_id = $1 AND kind = $2 AND due_date = $3`
+	ctx, end := startCall(ctx, "ReminderRepository", "Unmark", query)
+	defer end(&err)
+
+	if _, err = s.db.ExecContext(ctx, query, subscriptionID, kind, due); err != nil {
+		logger.FromContext(ctx).Errorf("Error removing reminder: %v", err)
+		return err
+	}
+	return nil
+}
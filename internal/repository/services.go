@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// ServiceRepository stores the service catalog used to give subscriptions
+// canonical service names.
+type ServiceRepository interface {
+	Create(ctx context.Context, svc *model.Service) error
+	GetByID(ctx context.Context, id string) (*model.Service, error)
+	List(ctx context.Context) ([]*model.Service, error)
+	Update(ctx context.Context, svc *model.Service) (bool, error)
+	Delete(ctx context.Context, id string) (bool, error)
+	Resolve(ctx context.Context, name string) (*model.Service, error)
+}
+
+type serviceRepo struct {
+	db *sql.DB
+}
+
+func NewServiceRepo(db *sql.DB) ServiceRepository {
+	return &serviceRepo{db: db}
+}
+
+const serviceColumns = `id, name, aliases, category, vendor_url, created_at`
+
+// serviceMatch returns a condition matching a catalog entry by name or
+// alias, ignoring case and surrounding spaces, against placeholder param.
+func serviceMatch(param string) string {
+	return `lower(name) = lower(trim(` + param + `)) OR lower(trim(` + param + `)) = ANY(SELECT lower(a) FROM unnest(aliases) a)`
+}
+
+// serviceFilter appends a service name condition to a query ending in a
+// WHERE clause. Subscriptions match by their own service_name or by the
+// catalog entry the name resolves to, so aliases count as one service.
+func serviceFilter(query string, args []any, name string) (string, []any) {
+	args = append(args, name)
+	param := "$" + strconv.Itoa(len(args))
+	query += " AND (service_name = " + param +
+		" OR service_id IN (SELECT id FROM services WHERE " + serviceMatch(param) + "))"
+	return query, args
+}
+
+func scanService(row rowScanner) (*model.Service, error) {
+	svc := &model.Service{}
+	var category, vendorURL sql.NullString
+	err := row.Scan(&svc.ID, &svc.Name, pq.Array(&svc.Aliases), &category, &vendorURL, &svc.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	svc.Category = category.String
+	svc.VendorURL = vendorURL.String
+	if svc.Aliases == nil {
+		svc.Aliases = []string{}
+	}
+	return svc, nil
+}
+
+// normalizeAliases trims the aliases and drops empty ones and duplicates of
+// the canonical name.
+func normalizeAliases(name string, aliases []string) []string {
+	out := []string{}
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(name)): true}
+	for _, a := range aliases {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[strings.ToLower(a)] {
+			continue
+		}
+		seen[strings.ToLower(a)] = true
+		out = append(out, a)
+	}
+	return out
+}
+
+// linkSubscriptions links the subscriptions without a service whose
+// service_name matches the name or an alias of svc, ignoring case, and gives
+// them its canonical name. With rename, the subscriptions already linked to
+// svc are given its name too. Changed subscriptions are announced in the
+// outbox.
+func linkSubscriptions(ctx context.Context, q querier, svc *model.Service, rename bool) error {
+	subs, err := changedRows(ctx, q, `UPDATE subscriptions SET service_id = $1, service_name = $2
+		 WHERE service_id IS NULL AND EXISTS (SELECT 1 FROM services WHERE id = $1
+		 AND (`+serviceMatch("subscriptions.service_name")+`))
+		 RETURNING `+subscriptionColumns, []any{svc.ID, svc.Name})
+	if err != nil {
+		return err
+	}
+	if rename {
+		renamed, err := changedRows(ctx, q, `UPDATE subscriptions SET service_name = $2
+			 WHERE service_id = $1 AND service_name <> $2 RETURNING `+subscriptionColumns, []any{svc.ID, svc.Name})
+		if err != nil {
+			return err
+		}
+		subs = append(subs, renamed...)
+	}
+
+	if err := loadHistory(ctx, q, subs); err != nil {
+		return err
+	}
+	return enqueueChanged(ctx, q, model.EventSubscriptionUpdated, subs)
+}
+
+// Create adds a catalog entry and links the existing subscriptions it
+// matches.
+func (s *serviceRepo) Create(ctx context.Context, svc *model.Service) (err error) {
+	const query = `INSERT INTO services (id, name, aliases, category, vendor_url, created_at)
+		 VALUES ($1,$2,$3,$4,$5,$6)`
+	ctx, end := startCall(ctx, "ServiceRepository", "Create", query)
+	defer end(&err)
+
+	if svc.ID == "" {
+		svc.ID = uuid.New().String()
+	}
+	svc.Name = strings.TrimSpace(svc.Name)
+	svc.Aliases = normalizeAliases(svc.Name, svc.Aliases)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query,
+		svc.ID, svc.Name, pq.Array(svc.Aliases), nullString(svc.Category), nullString(svc.VendorURL), svc.CreatedAt,
+	)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting service: %v", err)
+		return err
+	}
+	if err := linkSubscriptions(ctx, tx, svc, false); err != nil {
+		logger.FromContext(ctx).Errorf("Error linking subscriptions: %v", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *serviceRepo) GetByID(ctx context.Context, id string) (_ *model.Service, err error) {
+	const query = `SELECT ` + serviceColumns + ` FROM services WHERE id = $1`
+	ctx, end := startCall(ctx, "ServiceRepository", "GetByID", query)
+	defer end(&err)
+
+	svc, err := scanService(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching service: %v", err)
+		return nil, err
+	}
+
+	return svc, nil
+}
+
+func (s *serviceRepo) List(ctx context.Context) (_ []*model.Service, err error) {
+	const query = `SELECT ` + serviceColumns + ` FROM services ORDER BY name`
+	ctx, end := startCall(ctx, "ServiceRepository", "List", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing services: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var services []*model.Service
+	for rows.Next() {
+		svc, err := scanService(rows)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+	setRows(ctx, len(services))
+
+	return services, rows.Err()
+}
+
+// Update replaces the catalog entry, renames linked subscriptions to the new
+// canonical name and links the existing subscriptions it now matches. It
+// reports false when the service does not exist.
+func (s *serviceRepo) Update(ctx context.Context, svc *model.Service) (_ bool, err error) {
+	const query = `UPDATE services SET name=$1, aliases=$2, category=$3, vendor_url=$4 WHERE id=$5`
+	ctx, end := startCall(ctx, "ServiceRepository", "Update", query)
+	defer end(&err)
+
+	svc.Name = strings.TrimSpace(svc.Name)
+	svc.Aliases = normalizeAliases(svc.Name, svc.Aliases)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query,
+		svc.Name, pq.Array(svc.Aliases), nullString(svc.Category), nullString(svc.VendorURL), svc.ID,
+	)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error updating service: %v", err)
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := linkSubscriptions(ctx, tx, svc, true); err != nil {
+		logger.FromContext(ctx).Errorf("Error renaming subscriptions: %v", err)
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Delete removes a catalog entry. Linked subscriptions keep their
+// service_name and lose the reference, which is announced in the outbox.
+func (s *serviceRepo) Delete(ctx context.Context, id string) (_ bool, err error) {
+	const query = `DELETE FROM services WHERE id = $1`
+	ctx, end := startCall(ctx, "ServiceRepository", "Delete", query)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	subs, err := changedRows(ctx, tx, `UPDATE subscriptions SET service_id = NULL WHERE service_id = $1
+		 RETURNING `+subscriptionColumns, []any{id})
+	if err == nil {
+		err = loadHistory(ctx, tx, subs)
+	}
+	if err == nil {
+		err = enqueueChanged(ctx, tx, model.EventSubscriptionUpdated, subs)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error unlinking subscriptions: %v", err)
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error deleting service: %v", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, tx.Commit()
+}
+
+// Resolve finds the catalog entry whose name or one of whose aliases
+// matches name, ignoring case. It returns nil when there is none.
+func (s *serviceRepo) Resolve(ctx context.Context, name string) (_ *model.Service, err error) {
+	query := `SELECT ` + serviceColumns + ` FROM services WHERE ` + serviceMatch("$1") + ` LIMIT 1`
+	ctx, end := startCall(ctx, "ServiceRepository", "Resolve", query)
+	defer end(&err)
+
+	svc, err := scanService(s.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error resolving service: %v", err)
+		return nil, err
+	}
+
+	return svc, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/google/uuid"
+)
+
+func createTestService(t *testing.T, services ServiceRepository) *model.Service {
+	suffix := uuid.New().String()
+	svc := &model.Service{
+		Name:      "Yandex Plus " + suffix,
+		Aliases:   []string{"yandex plus " + suffix, "Яндекс Плюс " + suffix},
+		Category:  "streaming",
+		CreatedAt: time.Now(),
+	}
+	if err := services.Create(context.Background(), svc); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	return svc
+}
+
+func TestResolveService(t *testing.T) {
+	services := NewServiceRepo(testDB)
+	svc := createTestService(t, services)
+
+	for _, name := range []string{svc.Name, svc.Aliases[1], "  " + svc.Aliases[0] + " "} {
+		got, err := services.Resolve(context.Background(), name)
+		if err != nil {
+			t.Fatalf("Resolve(%q) failed: %v", name, err)
+		}
+		if got == nil || got.ID != svc.ID {
+			t.Errorf("Resolve(%q) = %v, want service %s", name, got, svc.ID)
+		}
+	}
+
+	got, err := services.Resolve(context.Background(), "Unknown "+uuid.New().String())
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if got != nil {
+		t.Errorf("Expected no service, got %v", got)
+	}
+}
+
+func TestCreateServiceLinksSubscriptions(t *testing.T) {
+	services := NewServiceRepo(testDB)
+	userID := createTestUser(t)
+	suffix := uuid.New().String()
+
+	var subs []*model.Subscription
+	for _, name := range []string{"  okko " + suffix, "Окко " + suffix, "Other " + suffix} {
+		sub := &model.Subscription{ServiceName: name, Price: rub(100), UserID: userID, StartDate: "2026-01-01", CreatedAt: time.Now()}
+		if err := testRepo.Create(context.Background(), sub); err != nil {
+			t.Fatalf("Failed to create subscription: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	svc := &model.Service{Name: "Okko " + suffix, Aliases: []string{"Окко " + suffix}, CreatedAt: time.Now()}
+	if err := services.Create(context.Background(), svc); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	for i, sub := range subs {
+		check, _ := testRepo.GetByID(context.Background(), sub.ID)
+		if linked := check.ServiceID == svc.ID && check.ServiceName == svc.Name; linked != (i < 2) {
+			t.Errorf("Subscription %q linked = %v, got %q %q", sub.ServiceName, linked, check.ServiceID, check.ServiceName)
+		}
+		if n := countEvents(t, model.EventSubscriptionUpdated, sub.ID); (n == 1) != (i < 2) {
+			t.Errorf("Subscription %q has %d update events", sub.ServiceName, n)
+		}
+	}
+
+	svc.Name = "Okko Renamed " + suffix
+	if _, err := services.Update(context.Background(), svc); err != nil {
+		t.Fatalf("Failed to update service: %v", err)
+	}
+	if n := countEvents(t, model.EventSubscriptionUpdated, subs[0].ID); n != 2 {
+		t.Errorf("Expected an update event for the rename, got %d events", n)
+	}
+
+	from, _ := time.Parse("2006-01-02", "2026-01-01")
+	to, _ := time.Parse("2006-01-02", "2026-01-31")
+	name := svc.Name
+	total, err := testRepo.Total(context.Background(), &userID, &name, from, to)
+	if err != nil {
+		t.Fatalf("Total failed: %v", err)
+	}
+	if total != rub(200) {
+		t.Errorf("Expected both old spellings to count, got %s", total)
+	}
+}
+
+func TestTotalMatchesCatalogAliases(t *testing.T) {
+	services := NewServiceRepo(testDB)
+	svc := createTestService(t, services)
+	userID := createTestUser(t)
+
+	for _, sub := range []*model.Subscription{
+		{ServiceName: svc.Name, ServiceID: svc.ID, Price: rub(100)},
+		{ServiceName: "Legacy free text", ServiceID: svc.ID, Price: rub(200)},
+		{ServiceName: "Other Service", Price: rub(400)},
+	} {
+		sub.UserID = userID
+		sub.StartDate = "2026-01-01"
+		sub.CreatedAt = time.Now()
+		if err := testRepo.Create(context.Background(), sub); err != nil {
+			t.Fatalf("Failed to create subscription: %v", err)
+		}
+	}
+
+	from, _ := time.Parse("2006-01-02", "2026-01-01")
+	to, _ := time.Parse("2006-01-02", "2026-12-31")
+	alias := svc.Aliases[1]
+	total, err := testRepo.Total(context.Background(), &userID, &alias, from, to)
+	if err != nil {
+		t.Fatalf("Total failed: %v", err)
+	}
+	if total != rub(12*300) {
+		t.Errorf("Expected total %s, got %s", rub(12*300), total)
+	}
+}
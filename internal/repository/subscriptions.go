@@ -1,181 +1,831 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/lifecycle"
+	"github.com/Elmar006/subscription_service/internal/metrics"
 	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/tenant"
 	"github.com/Elmar006/subscription_service/logger"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// SubscriptionRepository stores subscriptions. When the context is scoped to
+// an organization with tenant.WithOrg, every method only sees and changes
+// that organization's subscriptions.
 type SubscriptionRepository interface {
-	Create(sub *model.Subscription) error
-	GetByID(id string) (*model.Subscription, error)
-	Update(sub *model.Subscription) error
-	Delete(id string) error
-	ListByUser(userID string) ([]*model.Subscription, error)
-	Total(userID *string, serviceName *string, from, to time.Time) (int, error)
+	Create(ctx context.Context, sub *model.Subscription) error
+	GetByID(ctx context.Context, id string) (*model.Subscription, error)
+	Update(ctx context.Context, sub *model.Subscription) error
+	Delete(ctx context.Context, id string) error
+	ListByUser(ctx context.Context, userID string) ([]*model.Subscription, error)
+	ListAll(ctx context.Context, userID *string) ([]*model.Subscription, error)
+	DeleteByUser(ctx context.Context, userID string) (int, error)
+	ListBetween(ctx context.Context, userID *string, serviceName *string, from, to time.Time) ([]*model.Subscription, error)
+	Total(ctx context.Context, userID *string, serviceName *string, from, to time.Time) (model.Money, error)
+	ActiveSummary(ctx context.Context, at time.Time) (int, map[string]model.Money, error)
+	Transition(ctx context.Context, sub *model.Subscription, to string, effective time.Time) (bool, error)
+	ListTrialsEnding(ctx context.Context, userID *string, from, to time.Time) ([]*model.Subscription, error)
+	ListInvolving(ctx context.Context, userID string, serviceName *string, from, to time.Time) ([]*model.Subscription, error)
 }
 
 type subscriptionRepo struct {
-	db *sql.DB
+	db  *sql.DB
+	rls bool
 }
 
 func NewSubscriptionRepo(db *sql.DB) SubscriptionRepository {
 	return &subscriptionRepo{db: db}
 }
 
-func parseDate(dateStr string) (time.Time, error) {
-	return time.Parse("2006-01-02", dateStr)
+// NewSubscriptionRepoWithRLS returns a repository that additionally runs
+// every query in a transaction with app.org_id set, for the row-level
+// security policies in migrations/optional.
+func NewSubscriptionRepoWithRLS(db *sql.DB) SubscriptionRepository {
+	return &subscriptionRepo{db: db, rls: true}
+}
+
+// querier is the subset of *sql.DB and *sql.Tx used by the repositories.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
-func (s *subscriptionRepo) Create(sub *model.Subscription) error {
-	startDate, err := parseDate(sub.StartDate)
+// conn runs fn against the database. With row-level security enabled and a
+// tenant in ctx, fn runs inside a transaction that sets app.org_id.
+func (s *subscriptionRepo) conn(ctx context.Context, fn func(q querier) error) error {
+	if !s.rls || tenant.OrgID(ctx) == "" {
+		return fn(s.db)
+	}
+	return s.inTx(ctx, fn)
+}
+
+// inTx runs fn inside a transaction, setting app.org_id when row-level
+// security is enabled and ctx has a tenant.
+func (s *subscriptionRepo) inTx(ctx context.Context, fn func(q querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	var endDate sql.NullTime
-	if sub.EndDate != "" {
-		t, err := parseDate(sub.EndDate)
-		if err != nil {
+	if orgID := tenant.OrgID(ctx); s.rls && orgID != "" {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('app.org_id', $1, true)`, orgID); err != nil {
 			return err
 		}
-		endDate = sql.NullTime{Time: t, Valid: true}
 	}
-
-	if sub.ID == "" {
-		sub.ID = uuid.New().String()
+	if err := fn(tx); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
+
+var tracer = otel.Tracer("github.com/Elmar006/subscription_service/internal/repository")
 
-	_, err = s.db.Exec(
-		`INSERT INTO subscriptions (id, service_name, price, user_id, start_date, end_date, created_at)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
-		sub.ID, sub.ServiceName, sub.Price, sub.UserID, startDate, endDate, sub.CreatedAt,
+// startCall opens a span for a method of the repository named repo and
+// returns a function that ends it and reports the call to the metrics
+// package. The returned function is meant to be deferred with a pointer to
+// the method's named error result.
+func startCall(ctx context.Context, repo, method, query string) (context.Context, func(err *error)) {
+	start := time.Now()
+	name := repo + "." + method
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(method),
+			semconv.DBQueryText(query),
+		),
 	)
-	if err != nil {
-		logger.L().Errorf("Error inserting subscription: %v", err)
-		return err
+
+	return ctx, func(err *error) {
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+		metrics.ObserveQuery(name, start, *err)
 	}
+}
 
-	return nil
+// setRows records the number of rows returned or affected by a query on the
+// current span.
+func setRows(ctx context.Context, n int) {
+	trace.SpanFromContext(ctx).SetAttributes(semconv.DBResponseReturnedRows(n))
+}
+
+// scopeToOrg appends an org_id condition to a query ending in a WHERE clause
+// when ctx is scoped to a tenant.
+func scopeToOrg(ctx context.Context, query string, args []any) (string, []any) {
+	if orgID := tenant.OrgID(ctx); orgID != "" {
+		args = append(args, orgID)
+		query += " AND org_id = $" + strconv.Itoa(len(args))
+	}
+	return query, args
 }
 
-func (s *subscriptionRepo) GetByID(id string) (*model.Subscription, error) {
-	row := s.db.QueryRow(
-		`SELECT id, service_name, price, user_id, start_date, end_date, created_at
-		 FROM subscriptions WHERE id = $1`, id)
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const subscriptionColumns = `id, service_name, service_id, plan_id, price, currency, billing_period, user_id, org_id,
+	start_date, end_date, trial_end_date, intro_price, intro_months, status, category, created_at`
+
+// today returns the current calendar date in the zone of ctx as midnight
+// UTC, like zone.TodayIn, which this package cannot import.
+func today(ctx context.Context) time.Time {
+	y, m, d := time.Now().In(tenant.Location(ctx)).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
 
+// scanSubscription reads one subscription row and reports its status on
+// day, the caller's current date.
+func scanSubscription(row rowScanner, day time.Time) (*model.Subscription, error) {
 	sub := &model.Subscription{}
+	var serviceID, planID, orgID, category sql.NullString
 	var startDate time.Time
-	var endDate sql.NullTime
+	var endDate, trialEndDate sql.NullTime
+	var introPrice sql.NullInt64
+	var status string
 
-	err := row.Scan(&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &startDate, &endDate, &sub.CreatedAt)
+	err := row.Scan(&sub.ID, &sub.ServiceName, &serviceID, &planID, &sub.Price.Amount, &sub.Price.Currency, &sub.BillingPeriod,
+		&sub.UserID, &orgID, &startDate, &endDate, &trialEndDate, &introPrice, &sub.IntroMonths, &status, &category, &sub.CreatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		logger.L().Errorf("Error fetching subscription: %v", err)
 		return nil, err
 	}
 
-	sub.StartDate = startDate.Format("2006-01-02")
+	sub.ServiceID = serviceID.String
+	sub.PlanID = planID.String
+	sub.OrgID = orgID.String
+	sub.Category = category.String
+	sub.StartDate = model.DateOf(startDate)
 	if endDate.Valid {
-		sub.EndDate = endDate.Time.Format("2006-01-02")
+		sub.EndDate = model.DateOf(endDate.Time)
+	}
+	if trialEndDate.Valid {
+		sub.TrialEndDate = model.DateOf(trialEndDate.Time)
 	}
+	if introPrice.Valid {
+		sub.IntroPrice = &model.Money{Amount: introPrice.Int64, Currency: sub.Price.Currency}
+	}
+	sub.Status = lifecycle.Current(status, sub, day)
 
 	return sub, nil
 }
 
-func (s *subscriptionRepo) Update(sub *model.Subscription) error {
-	startDate, err := parseDate(sub.StartDate)
+// loadHistory fills the status transitions, the pending price changes, the
+// tags and the members of subs.
+func loadHistory(ctx context.Context, q querier, subs []*model.Subscription) error {
+	if err := loadTransitions(ctx, q, subs); err != nil {
+		return err
+	}
+	if err := loadPriceChanges(ctx, q, subs); err != nil {
+		return err
+	}
+	if err := loadTags(ctx, q, subs); err != nil {
+		return err
+	}
+	return loadMembers(ctx, q, subs)
+}
+
+// loadTransitions fills the status transitions of subs in chronological
+// order.
+func loadTransitions(ctx context.Context, q querier, subs []*model.Subscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Subscription, len(subs))
+	ids := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+		ids = append(ids, sub.ID)
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT subscription_id, from_status, to_status, effective_date, created_at
+		 FROM subscription_transitions WHERE subscription_id = ANY($1) ORDER BY created_at`, pq.Array(ids))
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	var endDate sql.NullTime
-	if sub.EndDate != "" {
-		t, err := parseDate(sub.EndDate)
-		if err != nil {
+	for rows.Next() {
+		var id string
+		var t model.Transition
+		var effective time.Time
+		if err := rows.Scan(&id, &t.From, &t.To, &effective, &t.CreatedAt); err != nil {
 			return err
 		}
-		endDate = sql.NullTime{Time: t, Valid: true}
+		t.EffectiveDate = model.DateOf(effective)
+		byID[id].Transitions = append(byID[id].Transitions, t)
+	}
+	return rows.Err()
+}
+
+// loadPriceChanges fills the price changes of subs, applied ones included,
+// in the order they take effect.
+func loadPriceChanges(ctx context.Context, q querier, subs []*model.Subscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Subscription, len(subs))
+	ids := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+		ids = append(ids, sub.ID)
 	}
 
-	_, err = s.db.Exec(
-		`UPDATE subscriptions SET service_name=$1, price=$2, start_date=$3, end_date=$4 WHERE id=$5`,
-		sub.ServiceName, sub.Price, startDate, endDate, sub.ID,
-	)
+	rows, err := q.QueryContext(ctx, `SELECT id, subscription_id, price, previous_price, effective_date, applied_at, created_at
+		 FROM price_changes WHERE subscription_id = ANY($1)
+		 ORDER BY effective_date, created_at`, pq.Array(ids))
 	if err != nil {
-		logger.L().Errorf("Error updating subscription: %v", err)
 		return err
 	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		var pc model.PriceChange
+		var previous sql.NullInt64
+		var effective time.Time
+		var applied sql.NullTime
+		if err := rows.Scan(&pc.ID, &pc.SubscriptionID, &pc.Price.Amount, &previous, &effective, &applied, &pc.CreatedAt); err != nil {
+			return err
+		}
+		pc.Price.Currency = byID[pc.SubscriptionID].Price.Currency
+		if previous.Valid {
+			pc.PreviousPrice = &model.Money{Amount: previous.Int64, Currency: pc.Price.Currency}
+		}
+		pc.EffectiveDate = model.DateOf(effective)
+		if applied.Valid {
+			pc.AppliedAt = &applied.Time
+		}
+		byID[pc.SubscriptionID].PriceChanges = append(byID[pc.SubscriptionID].PriceChanges, pc)
+	}
+	return rows.Err()
+}
+
+// loadTags fills the tags of subs in alphabetical order.
+func loadTags(ctx context.Context, q querier, subs []*model.Subscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Subscription, len(subs))
+	ids := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+		ids = append(ids, sub.ID)
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT subscription_id, tag FROM subscription_tags
+		 WHERE subscription_id = ANY($1) ORDER BY tag`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		byID[id].Tags = append(byID[id].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// saveTags replaces the tags of sub.
+func saveTags(ctx context.Context, q querier, sub *model.Subscription) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM subscription_tags WHERE subscription_id = $1`, sub.ID); err != nil {
+		return err
+	}
+	if len(sub.Tags) == 0 {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, `INSERT INTO subscription_tags (subscription_id, tag)
+		 SELECT $1, unnest($2::text[])`, sub.ID, pq.Array(sub.Tags))
+	return err
 }
 
-func (s *subscriptionRepo) Delete(id string) error {
-	_, err := s.db.Exec(`DELETE FROM subscriptions WHERE id=$1`, id)
+// loadMembers fills the members of subs in the order they were given.
+func loadMembers(ctx context.Context, q querier, subs []*model.Subscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Subscription, len(subs))
+	ids := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+		ids = append(ids, sub.ID)
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT subscription_id, user_id, weight, amount FROM subscription_members
+		 WHERE subscription_id = ANY($1) ORDER BY position`, pq.Array(ids))
 	if err != nil {
-		logger.L().Errorf("Error deleting subscription: %v", err)
 		return err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var m model.Member
+		var amount sql.NullInt64
+		if err := rows.Scan(&id, &m.UserID, &m.Weight, &amount); err != nil {
+			return err
+		}
+		if amount.Valid {
+			m.Amount = &model.Money{Amount: amount.Int64, Currency: byID[id].Price.Currency}
+		}
+		byID[id].Members = append(byID[id].Members, m)
+	}
+	return rows.Err()
+}
+
+// saveMembers replaces the members of sub.
+func saveMembers(ctx context.Context, q querier, sub *model.Subscription) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM subscription_members WHERE subscription_id = $1`, sub.ID); err != nil {
+		return err
+	}
+	for i, m := range sub.Members {
+		_, err := q.ExecContext(ctx, `INSERT INTO subscription_members (subscription_id, user_id, position, weight, amount)
+			 VALUES ($1, $2, $3, $4, $5)`, sub.ID, m.UserID, i, m.Weight, nullMoney(m.Amount))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (s *subscriptionRepo) ListByUser(userID string) ([]*model.Subscription, error) {
-	rows, err := s.db.Query(
-		`SELECT id, service_name, price, user_id, start_date, end_date, created_at FROM subscriptions WHERE user_id=$1`,
-		userID)
+// NormalizeLabel normalises a tag or category: case, surrounding and
+// repeated spaces are ignored.
+func NormalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// normalizeTags normalises tags, drops empty ones and duplicates and sorts
+// the rest.
+func normalizeTags(tags []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = NormalizeLabel(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// subscriptionDates parses the optional dates of sub for writing. A month
+// starts the subscription on its first day and ends it or its trial on its
+// last day.
+func subscriptionDates(sub *model.Subscription) (start time.Time, end, trialEnd sql.NullTime, err error) {
+	start, err = sub.StartDate.First()
+	if err != nil {
+		return
+	}
+	if sub.EndDate != "" {
+		var t time.Time
+		if t, err = sub.EndDate.Last(); err != nil {
+			return
+		}
+		end = sql.NullTime{Time: t, Valid: true}
+	}
+	if sub.TrialEndDate != "" {
+		var t time.Time
+		if t, err = sub.TrialEndDate.Last(); err != nil {
+			return
+		}
+		trialEnd = sql.NullTime{Time: t, Valid: true}
+	}
+	return
+}
+
+// nullMoney returns the amount of an optional price, which is stored in the
+// currency of its subscription.
+func nullMoney(v *model.Money) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: v.Amount, Valid: true}
+}
+
+// emitChanged runs a write returning the affected subscriptions and writes
+// an event of the given type for each of them to the outbox. It returns the
+// number of subscriptions changed.
+func emitChanged(ctx context.Context, q querier, eventType, query string, args []any) (int, error) {
+	subs, err := changedRows(ctx, q, query, args)
+	if err != nil {
+		return 0, err
+	}
+	if err := enqueueChanged(ctx, q, eventType, subs); err != nil {
+		return 0, err
+	}
+	return len(subs), nil
+}
+
+// changedRows runs a write returning the affected subscriptions.
+func changedRows(ctx context.Context, q querier, query string, args []any) ([]*model.Subscription, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		logger.L().Errorf("Error listing subscriptions: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
+	day := today(ctx)
 	var subs []*model.Subscription
 	for rows.Next() {
-		sub := &model.Subscription{}
-		var startDate time.Time
-		var endDate sql.NullTime
-		if err := rows.Scan(&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &startDate, &endDate, &sub.CreatedAt); err != nil {
+		sub, err := scanSubscription(rows, day)
+		if err != nil {
 			return nil, err
 		}
-		sub.StartDate = startDate.Format("2006-01-02")
-		if endDate.Valid {
-			sub.EndDate = endDate.Time.Format("2006-01-02")
-		}
 		subs = append(subs, sub)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	setRows(ctx, len(subs))
+	return subs, nil
+}
+
+// enqueueChanged writes an event of the given type for each of subs to the
+// outbox.
+func enqueueChanged(ctx context.Context, q querier, eventType string, subs []*model.Subscription) error {
+	for _, sub := range subs {
+		if _, err := enqueueEvent(ctx, q, eventType, sub.OrgID, "", sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *subscriptionRepo) Create(ctx context.Context, sub *model.Subscription) (err error) {
+	const query = `INSERT INTO subscriptions (id, service_name, service_id, plan_id, price, currency, billing_period, user_id, org_id,
+		 start_date, end_date, trial_end_date, intro_price, intro_months, category, created_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`
+	ctx, end := startCall(ctx, "SubscriptionRepository", "Create", query)
+	defer end(&err)
+
+	startDate, endDate, trialEndDate, err := subscriptionDates(sub)
+	if err != nil {
+		return err
+	}
+
+	if sub.ID == "" {
+		sub.ID = uuid.New().String()
+	}
+	if sub.BillingPeriod == "" {
+		sub.BillingPeriod = model.BillingMonthly
+	}
+	if orgID := tenant.OrgID(ctx); orgID != "" {
+		sub.OrgID = orgID
+	}
+	sub.Category = NormalizeLabel(sub.Category)
+	sub.Tags = normalizeTags(sub.Tags)
+
+	sub.Status = lifecycle.Current(model.StatusActive, sub, today(ctx))
+
+	err = s.inTx(ctx, func(q querier) error {
+		_, err := q.ExecContext(ctx, query,
+			sub.ID, sub.ServiceName, nullString(sub.ServiceID), nullString(sub.PlanID), sub.Price.Amount, sub.Price.Currency, sub.BillingPeriod,
+			sub.UserID, nullString(sub.OrgID), startDate, endDate, trialEndDate, nullMoney(sub.IntroPrice), sub.IntroMonths, nullString(sub.Category), sub.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := saveTags(ctx, q, sub); err != nil {
+			return err
+		}
+		if err := saveMembers(ctx, q, sub); err != nil {
+			return err
+		}
+		_, err = enqueueEvent(ctx, q, model.EventSubscriptionCreated, sub.OrgID, "", sub)
+		return err
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting subscription: %v", err)
+		return userError(err)
+	}
+
+	return nil
+}
+
+func (s *subscriptionRepo) GetByID(ctx context.Context, id string) (_ *model.Subscription, err error) {
+	query, args := scopeToOrg(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1`, []any{id})
+	ctx, end := startCall(ctx, "SubscriptionRepository", "GetByID", query)
+	defer end(&err)
+
+	var sub *model.Subscription
+	err = s.conn(ctx, func(q querier) error {
+		var err error
+		sub, err = scanSubscription(q.QueryRowContext(ctx, query, args...), today(ctx))
+		if err != nil {
+			return err
+		}
+		return loadHistory(ctx, q, []*model.Subscription{sub})
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			setRows(ctx, 0)
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching subscription: %v", err)
+		return nil, err
+	}
+	setRows(ctx, 1)
+
+	return sub, nil
+}
+
+func (s *subscriptionRepo) Update(ctx context.Context, sub *model.Subscription) (err error) {
+	startDate, endDate, trialEndDate, err := subscriptionDates(sub)
+	if err != nil {
+		return err
+	}
+	sub.Category = NormalizeLabel(sub.Category)
+	sub.Tags = normalizeTags(sub.Tags)
+
+	query, args := scopeToOrg(ctx,
+		`UPDATE subscriptions SET service_name=$1, service_id=$2, plan_id=$3, price=$4, currency=$5, billing_period=$6,
+		 start_date=$7, end_date=$8, trial_end_date=$9, intro_price=$10, intro_months=$11, category=$12 WHERE id=$13`,
+		[]any{sub.ServiceName, nullString(sub.ServiceID), nullString(sub.PlanID), sub.Price.Amount, sub.Price.Currency, sub.BillingPeriod,
+			startDate, endDate, trialEndDate, nullMoney(sub.IntroPrice), sub.IntroMonths, nullString(sub.Category), sub.ID})
+	query += " RETURNING " + subscriptionColumns
+	ctx, end := startCall(ctx, "SubscriptionRepository", "Update", query)
+	defer end(&err)
+
+	err = s.inTx(ctx, func(q querier) error {
+		subs, err := changedRows(ctx, q, query, args)
+		if err != nil || len(subs) == 0 {
+			return err
+		}
+		if err := saveTags(ctx, q, sub); err != nil {
+			return err
+		}
+		if err := saveMembers(ctx, q, sub); err != nil {
+			return err
+		}
+		if err := loadHistory(ctx, q, subs); err != nil {
+			return err
+		}
+		return enqueueChanged(ctx, q, model.EventSubscriptionUpdated, subs)
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error updating subscription: %v", err)
+		return userError(err)
+	}
+
+	return nil
+}
+
+func (s *subscriptionRepo) Delete(ctx context.Context, id string) (err error) {
+	query, args := scopeToOrg(ctx, `DELETE FROM subscriptions WHERE id=$1`, []any{id})
+	query += " RETURNING " + subscriptionColumns
+	ctx, end := startCall(ctx, "SubscriptionRepository", "Delete", query)
+	defer end(&err)
+
+	err = s.inTx(ctx, func(q querier) error {
+		_, err := emitChanged(ctx, q, model.EventSubscriptionDeleted, query, args)
+		return err
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error deleting subscription: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *subscriptionRepo) ListByUser(ctx context.Context, userID string) ([]*model.Subscription, error) {
+	query, args := scopeToOrg(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE user_id=$1`, []any{userID})
+	return s.list(ctx, "ListByUser", query, args)
+}
+
+// ListAll returns every subscription, optionally only those of one user,
+// ordered by creation time.
+func (s *subscriptionRepo) ListAll(ctx context.Context, userID *string) ([]*model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE TRUE`
+	var args []any
+	if userID != nil {
+		args = append(args, *userID)
+		query += " AND user_id = $1"
+	}
+	query, args = scopeToOrg(ctx, query, args)
+	return s.list(ctx, "ListAll", query+" ORDER BY created_at", args)
+}
+
+func (s *subscriptionRepo) list(ctx context.Context, method, query string, args []any) (_ []*model.Subscription, err error) {
+	ctx, end := startCall(ctx, "SubscriptionRepository", method, query)
+	defer end(&err)
+
+	var subs []*model.Subscription
+	err = s.conn(ctx, func(q querier) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		day := today(ctx)
+		for rows.Next() {
+			sub, err := scanSubscription(rows, day)
+			if err != nil {
+				return err
+			}
+			subs = append(subs, sub)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		return loadHistory(ctx, q, subs)
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing subscriptions: %v", err)
+		return nil, err
+	}
+	setRows(ctx, len(subs))
 
 	return subs, nil
 }
 
-func (s *subscriptionRepo) Total(userID *string, serviceName *string, from, to time.Time) (int, error) {
-	query := `SELECT COALESCE(SUM(price),0) FROM subscriptions WHERE start_date >= $1 AND start_date <= $2`
-	args := []interface{}{from, to}
-	argIndex := 3
+// DeleteByUser removes all subscriptions of a user and returns how many
+// were deleted.
+func (s *subscriptionRepo) DeleteByUser(ctx context.Context, userID string) (_ int, err error) {
+	query, args := scopeToOrg(ctx, `DELETE FROM subscriptions WHERE user_id=$1`, []any{userID})
+	query += " RETURNING " + subscriptionColumns
+	ctx, end := startCall(ctx, "SubscriptionRepository", "DeleteByUser", query)
+	defer end(&err)
+
+	var n int
+	err = s.inTx(ctx, func(q querier) error {
+		var err error
+		n, err = emitChanged(ctx, q, model.EventSubscriptionDeleted, query, args)
+		return err
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error purging subscriptions: %v", err)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// ListBetween returns the subscriptions running at some point between from
+// and to, optionally filtered by user and service like Total.
+func (s *subscriptionRepo) ListBetween(ctx context.Context, userID *string, serviceName *string, from, to time.Time) ([]*model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions
+		 WHERE start_date <= $1 AND (end_date IS NULL OR end_date >= $2)`
+	args := []any{to, from}
 
 	if userID != nil {
-		query += " AND user_id = $" + strconv.Itoa(argIndex)
 		args = append(args, *userID)
-		argIndex++
+		query += " AND user_id = $" + strconv.Itoa(len(args))
 	}
 
 	if serviceName != nil {
-		query += " AND service_name = $" + strconv.Itoa(argIndex)
-		args = append(args, *serviceName)
-		argIndex++
+		query, args = serviceFilter(query, args, *serviceName)
+	}
+
+	query, args = scopeToOrg(ctx, query, args)
+	return s.list(ctx, "ListBetween", query+" ORDER BY created_at", args)
+}
+
+// involving returns a condition matching the subscriptions that the user in
+// placeholder param pays for or is a member of.
+func involving(param string) string {
+	return `(user_id = ` + param + ` OR id IN (SELECT subscription_id FROM subscription_members WHERE user_id = ` + param + `))`
+}
+
+// ListInvolving returns the subscriptions running at some point between
+// from and to that userID pays for or is a member of, optionally filtered
+// by service like Total.
+func (s *subscriptionRepo) ListInvolving(ctx context.Context, userID string, serviceName *string, from, to time.Time) ([]*model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions
+		 WHERE start_date <= $1 AND (end_date IS NULL OR end_date >= $2) AND ` + involving("$3")
+	args := []any{to, from, userID}
+
+	if serviceName != nil {
+		query, args = serviceFilter(query, args, *serviceName)
+	}
+
+	query, args = scopeToOrg(ctx, query, args)
+	return s.list(ctx, "ListInvolving", query+" ORDER BY created_at", args)
+}
+
+// Total sums the charges due between from and to, see package billing, of
+// the subscriptions matching the filters. For a single user only their
+// share of the subscriptions they pay for or are a member of counts.
+// Subscriptions in different currencies give model.ErrMixedCurrencies.
+func (s *subscriptionRepo) Total(ctx context.Context, userID *string, serviceName *string, from, to time.Time) (model.Money, error) {
+	if userID != nil {
+		subs, err := s.ListInvolving(ctx, *userID, serviceName, from, to)
+		if err != nil {
+			return model.Money{}, err
+		}
+		return billing.ShareTotal(subs, *userID, from, to)
 	}
 
-	var total int
-	err := s.db.QueryRow(query, args...).Scan(&total)
+	subs, err := s.ListBetween(ctx, nil, serviceName, from, to)
 	if err != nil {
-		logger.L().Errorf("Error calculating total: %v", err)
-		return 0, err
+		return model.Money{}, err
+	}
+
+	return billing.Total(subs, from, to)
+}
+
+// ActiveSummary returns the number of subscriptions active on the given day
+// and their combined monthly cost on that day per currency. Subscriptions
+// in a trial count as active and cost nothing, paused ones are left out.
+func (s *subscriptionRepo) ActiveSummary(ctx context.Context, at time.Time) (int, map[string]model.Money, error) {
+	query, args := scopeToOrg(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions
+		 WHERE start_date <= $1 AND (end_date IS NULL OR end_date >= $1)`, []any{at})
+
+	subs, err := s.list(ctx, "ActiveSummary", query, args)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	active, spend := 0, map[string]model.Money{}
+	for _, sub := range subs {
+		if billing.Paused(sub, at) {
+			continue
+		}
+		active++
+		spend[sub.Price.Currency] = spend[sub.Price.Currency].Add(billing.MonthlyAmount(sub, at))
+	}
+	return active, spend, nil
+}
+
+// ListTrialsEnding returns the subscriptions whose trial converts to paid
+// between from and to, optionally only those of one user, soonest first.
+func (s *subscriptionRepo) ListTrialsEnding(ctx context.Context, userID *string, from, to time.Time) ([]*model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions
+		 WHERE trial_end_date >= $1 AND trial_end_date <= $2 AND (end_date IS NULL OR end_date >= trial_end_date)
+		 AND status = 'active'`
+	args := []any{from, to}
+	if userID != nil {
+		args = append(args, *userID)
+		query += " AND user_id = $" + strconv.Itoa(len(args))
+	}
+	query, args = scopeToOrg(ctx, query, args)
+	return s.list(ctx, "ListTrialsEnding", query+" ORDER BY trial_end_date", args)
+}
+
+// Transition changes the stored status of sub to to and records the change
+// as effective on the given day, together with sub's end date which a
+// cancellation may have moved. It reports false when the status was
+// changed concurrently or the subscription is gone.
+func (s *subscriptionRepo) Transition(ctx context.Context, sub *model.Subscription, to string, effective time.Time) (_ bool, err error) {
+	from := lifecycle.Stored(sub.Status)
+	query, args := scopeToOrg(ctx, `UPDATE subscriptions SET status=$1, end_date=$2 WHERE id=$3 AND status=$4`,
+		[]any{to, sql.NullTime{}, sub.ID, from})
+	query += " RETURNING " + subscriptionColumns
+	ctx, end := startCall(ctx, "SubscriptionRepository", "Transition", query)
+	defer end(&err)
+
+	if sub.EndDate != "" {
+		t, err := sub.EndDate.Last()
+		if err != nil {
+			return false, err
+		}
+		args[1] = sql.NullTime{Time: t, Valid: true}
+	}
+
+	updated := false
+	err = s.inTx(ctx, func(q querier) error {
+		n, err := emitChanged(ctx, q, model.EventSubscriptionUpdated, query, args)
+		if err != nil || n == 0 {
+			return err
+		}
+		updated = true
+
+		_, err = q.ExecContext(ctx, `INSERT INTO subscription_transitions (subscription_id, from_status, to_status, effective_date, created_at)
+			 VALUES ($1,$2,$3,$4,now())`, sub.ID, sub.Status, to, effective)
+		return err
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error changing subscription status: %v", err)
+		return false, err
 	}
 
-	return total, nil
+	return updated, nil
 }
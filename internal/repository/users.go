@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+var (
+	// ErrUnknownUser is returned when a subscription, one of its members or
+	// a reassignment refers to a user that does not exist.
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrEmailTaken is returned when another user already has the email.
+	ErrEmailTaken = errors.New("email already used by another user")
+	// ErrUserHasSubscriptions is returned when deleting a user who still
+	// pays for or shares subscriptions, or has budgets, without cascading
+	// or reassigning them.
+	ErrUserHasSubscriptions = errors.New("user has subscriptions")
+)
+
+// UserDeletion says what happens to the subscriptions and budgets of a
+// deleted user: they are deleted with Cascade or moved to ReassignTo.
+// Memberships in subscriptions shared with the user are moved to
+// ReassignTo, or dropped otherwise. Organization memberships are always
+// dropped.
+type UserDeletion struct {
+	Cascade    bool
+	ReassignTo string
+}
+
+// UserRepository stores users. Users are global, subscriptions of every
+// organization refer to the same users.
+type UserRepository interface {
+	Create(ctx context.Context, u *model.User) error
+	GetByID(ctx context.Context, id string) (*model.User, error)
+	List(ctx context.Context) ([]*model.User, error)
+	Update(ctx context.Context, u *model.User) (bool, error)
+	Delete(ctx context.Context, id string, how UserDeletion) (bool, error)
+}
+
+type userRepo struct {
+	db   *sql.DB
+	subs *subscriptionRepo
+}
+
+func NewUserRepo(db *sql.DB) UserRepository {
+	return &userRepo{db: db, subs: &subscriptionRepo{db: db}}
+}
+
+const userColumns = `id, name, email, timezone, currency, created_at`
+
+func scanUser(row rowScanner) (*model.User, error) {
+	u := &model.User{}
+	var email sql.NullString
+	if err := row.Scan(&u.ID, &u.Name, &email, &u.Timezone, &u.Currency, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	u.Email = email.String
+	return u, nil
+}
+
+// pqError returns the Postgres error wrapped in err, if any.
+func pqError(err error) *pq.Error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr
+	}
+	return nil
+}
+
+// userError translates violations of the user foreign keys to
+// ErrUnknownUser and of the email constraint to ErrEmailTaken.
+func userError(err error) error {
+	pqErr := pqError(err)
+	switch {
+	case pqErr == nil:
+		return err
+	case pqErr.Code == "23503" && strings.HasSuffix(pqErr.Constraint, "_user_id_fkey"):
+		return ErrUnknownUser
+	case pqErr.Code == "23505" && pqErr.Constraint == "users_email_key":
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (s *userRepo) Create(ctx context.Context, u *model.User) (err error) {
+	const query = `INSERT INTO users (id, name, email, timezone, currency, created_at) VALUES ($1,$2,$3,$4,$5,$6)`
+	ctx, end := startCall(ctx, "UserRepository", "Create", query)
+	defer end(&err)
+
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+
+	_, err = s.db.ExecContext(ctx, query, u.ID, u.Name, nullString(u.Email), u.Timezone, u.Currency, u.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting user: %v", err)
+		return userError(err)
+	}
+
+	return nil
+}
+
+func (s *userRepo) GetByID(ctx context.Context, id string) (_ *model.User, err error) {
+	const query = `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	ctx, end := startCall(ctx, "UserRepository", "GetByID", query)
+	defer end(&err)
+
+	u, err := scanUser(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching user: %v", err)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (s *userRepo) List(ctx context.Context) (_ []*model.User, err error) {
+	const query = `SELECT ` + userColumns + ` FROM users ORDER BY created_at`
+	ctx, end := startCall(ctx, "UserRepository", "List", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing users: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*model.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	setRows(ctx, len(users))
+
+	return users, rows.Err()
+}
+
+func (s *userRepo) Update(ctx context.Context, u *model.User) (_ bool, err error) {
+	const query = `UPDATE users SET name=$1, email=$2, timezone=$3, currency=$4 WHERE id=$5`
+	ctx, end := startCall(ctx, "UserRepository", "Update", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, u.Name, nullString(u.Email), u.Timezone, u.Currency, u.ID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error updating user: %v", err)
+		return false, userError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Delete removes a user, deleting or reassigning their subscriptions and
+// budgets as how says, in one transaction. Users are global, so this covers
+// the subscriptions of every organization whatever ctx is scoped to. Without either it fails with
+// ErrUserHasSubscriptions while the user has any. Changed subscriptions,
+// including those whose members changed, are announced in the outbox like
+// any other change.
+func (s *userRepo) Delete(ctx context.Context, id string, how UserDeletion) (_ bool, err error) {
+	const query = `DELETE FROM users WHERE id = $1`
+	ctx, end := startCall(ctx, "UserRepository", "Delete", query)
+	defer end(&err)
+
+	var found bool
+	err = s.subs.inTx(ctx, func(q querier) error {
+		var changed []string
+		switch {
+		case how.ReassignTo != "":
+			ids, err := reassignUser(ctx, q, id, how.ReassignTo)
+			if err != nil {
+				return err
+			}
+			changed = ids
+		case how.Cascade:
+			if _, err := emitChanged(ctx, q, model.EventSubscriptionDeleted, `DELETE FROM subscriptions WHERE user_id = $1
+				 RETURNING `+subscriptionColumns, []any{id}); err != nil {
+				return err
+			}
+			if _, err := q.ExecContext(ctx, `DELETE FROM budgets WHERE user_id = $1`, id); err != nil {
+				return err
+			}
+		default:
+			var used bool
+			err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE user_id = $1)
+				 OR EXISTS (SELECT 1 FROM subscription_members WHERE user_id = $1)
+				 OR EXISTS (SELECT 1 FROM budgets WHERE user_id = $1)`, id).Scan(&used)
+			if err != nil {
+				return err
+			}
+			if used {
+				return ErrUserHasSubscriptions
+			}
+		}
+
+		dropped, err := subscriptionIDs(ctx, q, `DELETE FROM subscription_members WHERE user_id = $1 RETURNING subscription_id`, id)
+		if err != nil {
+			return err
+		}
+		if err := announceUpdated(ctx, q, append(changed, dropped...)); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, `DELETE FROM org_members WHERE user_id = $1`, id); err != nil {
+			return err
+		}
+
+		res, err := q.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		found = n > 0
+		return err
+	})
+	if errors.Is(err, ErrUserHasSubscriptions) {
+		return false, err
+	}
+	if pqErr := pqError(err); pqErr != nil && pqErr.Code == "23503" && pqErr.Constraint == "subscriptions_user_id_fkey" {
+		return false, ErrUserHasSubscriptions
+	}
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error deleting user: %v", err)
+		return false, userError(err)
+	}
+
+	return found, nil
+}
+
+// reassignUser moves the subscriptions, memberships and budgets of user
+// from to user to and returns the IDs of the subscriptions it changed.
+func reassignUser(ctx context.Context, q querier, from, to string) ([]string, error) {
+	paid, err := subscriptionIDs(ctx, q, `UPDATE subscriptions SET user_id = $2 WHERE user_id = $1 RETURNING id`, from, to)
+	if err != nil {
+		return nil, userError(err)
+	}
+
+	// A membership is only moved when to is not a member already; the rest
+	// goes with the deleted user.
+	shared, err := subscriptionIDs(ctx, q, `UPDATE subscription_members m SET user_id = $2 WHERE user_id = $1
+		 AND NOT EXISTS (SELECT 1 FROM subscription_members o WHERE o.subscription_id = m.subscription_id AND o.user_id = $2)
+		 RETURNING subscription_id`, from, to)
+	if err != nil {
+		return nil, userError(err)
+	}
+	if _, err := q.ExecContext(ctx, `UPDATE budgets SET user_id = $2 WHERE user_id = $1`, from, to); err != nil {
+		return nil, err
+	}
+	return append(paid, shared...), nil
+}
+
+// subscriptionIDs runs a write returning subscription IDs and collects them.
+func subscriptionIDs(ctx context.Context, q querier, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// announceUpdated writes a subscription.updated event for each of the
+// subscriptions ids, once per subscription.
+func announceUpdated(ctx context.Context, q querier, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	subs, err := changedRows(ctx, q, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = ANY($1)`,
+		[]any{pq.Array(ids)})
+	if err != nil {
+		return err
+	}
+	if err := loadHistory(ctx, q, subs); err != nil {
+		return err
+	}
+	return enqueueChanged(ctx, q, model.EventSubscriptionUpdated, subs)
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+)
+
+func createTestUser(t *testing.T) string {
+	u := &model.User{Name: "Test User", Timezone: "UTC", Currency: "RUB", CreatedAt: time.Now()}
+	if err := NewUserRepo(testDB).Create(context.Background(), u); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return u.ID
+}
+
+func TestCreateSubscriptionUnknownUser(t *testing.T) {
+	sub := &model.Subscription{ServiceName: "Orphan", Price: rub(100), UserID: "00000000-0000-0000-0000-000000000001",
+		StartDate: "2026-01-01", CreatedAt: time.Now()}
+	if err := testRepo.Create(context.Background(), sub); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("Expected ErrUnknownUser, got %v", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	users := NewUserRepo(testDB)
+	ctx := context.Background()
+
+	owner, heir := createTestUser(t), createTestUser(t)
+	sub := &model.Subscription{ServiceName: "Inherited", Price: rub(100), UserID: owner, StartDate: "2026-01-01", CreatedAt: time.Now()}
+	if err := testRepo.Create(ctx, sub); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if _, err := users.Delete(ctx, owner, UserDeletion{}); !errors.Is(err, ErrUserHasSubscriptions) {
+		t.Fatalf("Expected ErrUserHasSubscriptions, got %v", err)
+	}
+
+	found, err := users.Delete(ctx, owner, UserDeletion{ReassignTo: heir})
+	if err != nil || !found {
+		t.Fatalf("Reassigning delete failed: %v, found %t", err, found)
+	}
+	check, _ := testRepo.GetByID(ctx, sub.ID)
+	if check == nil || check.UserID != heir {
+		t.Fatalf("Expected the subscription to move to %s, got %+v", heir, check)
+	}
+
+	// Users are global: a caller scoped to some organization still deletes
+	// the subscriptions the user has outside of it.
+	scoped := tenant.WithOrg(ctx, uuid.New().String())
+	if _, err := users.Delete(scoped, heir, UserDeletion{Cascade: true}); err != nil {
+		t.Fatalf("Cascading delete failed: %v", err)
+	}
+	if check, _ := testRepo.GetByID(ctx, sub.ID); check != nil {
+		t.Errorf("Expected the subscription to be deleted with its user")
+	}
+	if u, _ := users.GetByID(ctx, heir); u != nil {
+		t.Errorf("Expected the user to be deleted")
+	}
+}
+
+func TestDeleteSharingUser(t *testing.T) {
+	users := NewUserRepo(testDB)
+	ctx := context.Background()
+
+	payer, member := createTestUser(t), createTestUser(t)
+	sub := &model.Subscription{ServiceName: "Shared", Price: rub(300), UserID: payer, StartDate: "2026-01-01",
+		Members: []model.Member{{UserID: member}}, CreatedAt: time.Now()}
+	if err := testRepo.Create(ctx, sub); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	before := countEvents(t, model.EventSubscriptionUpdated, sub.ID)
+
+	if _, err := users.Delete(ctx, member, UserDeletion{}); !errors.Is(err, ErrUserHasSubscriptions) {
+		t.Fatalf("Expected ErrUserHasSubscriptions for a member, got %v", err)
+	}
+	if found, err := users.Delete(ctx, member, UserDeletion{Cascade: true}); err != nil || !found {
+		t.Fatalf("Cascading delete failed: %v, found %t", err, found)
+	}
+	check, _ := testRepo.GetByID(ctx, sub.ID)
+	if check == nil || len(check.Members) != 0 {
+		t.Fatalf("Expected the subscription to stay without members, got %+v", check)
+	}
+	if n := countEvents(t, model.EventSubscriptionUpdated, sub.ID); n != before+1 {
+		t.Errorf("Expected an update event for the dropped member, got %d after %d", n, before)
+	}
+}
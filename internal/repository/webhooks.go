@@ -0,0 +1,348 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// WebhookRepository stores webhook endpoints, the event outbox and the log
+// of deliveries. Webhooks registered in an organization only receive that
+// organization's events.
+type WebhookRepository interface {
+	Create(ctx context.Context, hook *model.Webhook) error
+	GetByID(ctx context.Context, id string) (*model.Webhook, error)
+	List(ctx context.Context) ([]*model.Webhook, error)
+	Delete(ctx context.Context, id string) (bool, error)
+	Enqueue(ctx context.Context, eventType, orgID, dedupKey string, data any) (bool, error)
+	Dispatch(ctx context.Context, limit int) (int, int, error)
+	Due(ctx context.Context, at time.Time, limit int) ([]*OutgoingDelivery, error)
+	RecordAttempt(ctx context.Context, d *model.Delivery) error
+	ListDeliveries(ctx context.Context, webhookID, status string, limit int) ([]*model.Delivery, error)
+	Redeliver(ctx context.Context, webhookID, deliveryID string) (bool, error)
+}
+
+// OutgoingDelivery is a pending delivery together with where to send it.
+type OutgoingDelivery struct {
+	model.Delivery
+	URL    string
+	Secret string
+}
+
+type webhookRepo struct {
+	db *sql.DB
+}
+
+func NewWebhookRepo(db *sql.DB) WebhookRepository {
+	return &webhookRepo{db: db}
+}
+
+// enqueueEvent writes an event to the outbox through q, so that it is
+// committed or rolled back together with the change it describes.
+func enqueueEvent(ctx context.Context, q querier, eventType, orgID, dedupKey string, data any) (bool, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := q.ExecContext(ctx, `INSERT INTO outbox_events (event_type, payload, org_id, dedup_key, created_at)
+		 VALUES ($1,$2,$3,$4,now()) ON CONFLICT (dedup_key) DO NOTHING`,
+		eventType, payload, nullString(orgID), nullString(dedupKey))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *webhookRepo) Create(ctx context.Context, hook *model.Webhook) (err error) {
+	const query = `INSERT INTO webhooks (id, url, secret, events, org_id, created_at) VALUES ($1,$2,$3,$4,$5,$6)`
+	ctx, end := startCall(ctx, "WebhookRepository", "Create", query)
+	defer end(&err)
+
+	if hook.ID == "" {
+		hook.ID = uuid.New().String()
+	}
+	if orgID := tenant.OrgID(ctx); orgID != "" {
+		hook.OrgID = orgID
+	}
+
+	_, err = s.db.ExecContext(ctx, query,
+		hook.ID, hook.URL, hook.Secret, pq.Array(hook.Events), nullString(hook.OrgID), hook.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error inserting webhook: %v", err)
+		return err
+	}
+	return nil
+}
+
+const webhookColumns = `id, url, secret, events, org_id, created_at`
+
+func scanWebhook(row rowScanner) (*model.Webhook, error) {
+	hook := &model.Webhook{}
+	var orgID sql.NullString
+	if err := row.Scan(&hook.ID, &hook.URL, &hook.Secret, pq.Array(&hook.Events), &orgID, &hook.CreatedAt); err != nil {
+		return nil, err
+	}
+	hook.OrgID = orgID.String
+	return hook, nil
+}
+
+func (s *webhookRepo) GetByID(ctx context.Context, id string) (_ *model.Webhook, err error) {
+	query, args := scopeToOrg(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, []any{id})
+	ctx, end := startCall(ctx, "WebhookRepository", "GetByID", query)
+	defer end(&err)
+
+	hook, err := scanWebhook(s.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Errorf("Error fetching webhook: %v", err)
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (s *webhookRepo) List(ctx context.Context) (_ []*model.Webhook, err error) {
+	query, args := scopeToOrg(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE TRUE`, nil)
+	query += " ORDER BY created_at"
+	ctx, end := startCall(ctx, "WebhookRepository", "List", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing webhooks: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*model.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	setRows(ctx, len(hooks))
+
+	return hooks, nil
+}
+
+// Delete removes the webhook with its delivery log and reports whether it
+// existed.
+func (s *webhookRepo) Delete(ctx context.Context, id string) (_ bool, err error) {
+	query, args := scopeToOrg(ctx, `DELETE FROM webhooks WHERE id = $1`, []any{id})
+	ctx, end := startCall(ctx, "WebhookRepository", "Delete", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error deleting webhook: %v", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Enqueue writes an event to the outbox on its own. It reports false when
+// an event with the same non-empty dedupKey was already written.
+func (s *webhookRepo) Enqueue(ctx context.Context, eventType, orgID, dedupKey string, data any) (_ bool, err error) {
+	ctx, end := startCall(ctx, "WebhookRepository", "Enqueue", "INSERT INTO outbox_events")
+	defer end(&err)
+
+	added, err := enqueueEvent(ctx, s.db, eventType, orgID, dedupKey, data)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error writing outbox event: %v", err)
+		return false, err
+	}
+	return added, nil
+}
+
+// Dispatch takes up to limit undispatched outbox events and creates a
+// pending delivery for every webhook subscribed to each of them. It returns
+// the number of events and of deliveries created.
+func (s *webhookRepo) Dispatch(ctx context.Context, limit int) (_ int, _ int, err error) {
+	const query = `WITH ev AS (
+			UPDATE outbox_events SET dispatched_at = now()
+			 WHERE id IN (SELECT id FROM outbox_events WHERE dispatched_at IS NULL
+			              ORDER BY created_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+			 RETURNING id, event_type, org_id
+		), ins AS (
+			INSERT INTO webhook_deliveries (webhook_id, event_id)
+			SELECT w.id, ev.id FROM ev
+			  JOIN webhooks w ON ev.event_type = ANY(w.events) AND (w.org_id IS NULL OR w.org_id = ev.org_id)
+			ON CONFLICT DO NOTHING
+			RETURNING 1
+		)
+		SELECT (SELECT count(*) FROM ev), (SELECT count(*) FROM ins)`
+	ctx, end := startCall(ctx, "WebhookRepository", "Dispatch", query)
+	defer end(&err)
+
+	var events, deliveries int
+	if err := s.db.QueryRowContext(ctx, query, limit).Scan(&events, &deliveries); err != nil {
+		logger.FromContext(ctx).Errorf("Error dispatching outbox events: %v", err)
+		return 0, 0, err
+	}
+	setRows(ctx, events)
+
+	return events, deliveries, nil
+}
+
+const deliveryColumns = `d.id, d.webhook_id, e.id, e.event_type, e.payload, e.created_at, d.status, d.attempts,
+	d.next_attempt_at, d.last_error, d.response_code, d.delivered_at, d.created_at`
+
+func scanDelivery(row rowScanner, extra ...any) (*model.Delivery, error) {
+	d := &model.Delivery{}
+	var payload []byte
+	var next, delivered sql.NullTime
+	var lastError sql.NullString
+	var code sql.NullInt64
+
+	dest := append([]any{&d.ID, &d.WebhookID, &d.Event.ID, &d.Event.Type, &payload, &d.Event.CreatedAt,
+		&d.Status, &d.Attempts, &next, &lastError, &code, &delivered, &d.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	d.Event.Data = payload
+	if next.Valid && d.Status == model.DeliveryPending {
+		d.NextAttemptAt = &next.Time
+	}
+	d.LastError = lastError.String
+	d.ResponseCode = int(code.Int64)
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return d, nil
+}
+
+// Due returns up to limit pending deliveries whose next attempt is due at
+// the given time, oldest first.
+func (s *webhookRepo) Due(ctx context.Context, at time.Time, limit int) (_ []*OutgoingDelivery, err error) {
+	const query = `SELECT ` + deliveryColumns + `, w.url, w.secret
+		 FROM webhook_deliveries d
+		 JOIN outbox_events e ON e.id = d.event_id
+		 JOIN webhooks w ON w.id = d.webhook_id
+		 WHERE d.status = 'pending' AND d.next_attempt_at <= $1
+		 ORDER BY d.next_attempt_at LIMIT $2`
+	ctx, end := startCall(ctx, "WebhookRepository", "Due", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query, at, limit)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing due deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*OutgoingDelivery
+	for rows.Next() {
+		var o OutgoingDelivery
+		d, err := scanDelivery(rows, &o.URL, &o.Secret)
+		if err != nil {
+			return nil, err
+		}
+		o.Delivery = *d
+		out = append(out, &o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	setRows(ctx, len(out))
+
+	return out, nil
+}
+
+// RecordAttempt stores the outcome of a delivery attempt: its status,
+// attempt count, response and when to try again.
+func (s *webhookRepo) RecordAttempt(ctx context.Context, d *model.Delivery) (err error) {
+	const query = `UPDATE webhook_deliveries SET status=$1, attempts=$2, next_attempt_at=COALESCE($3, next_attempt_at),
+		 last_error=$4, response_code=$5, delivered_at=$6 WHERE id=$7`
+	ctx, end := startCall(ctx, "WebhookRepository", "RecordAttempt", query)
+	defer end(&err)
+
+	code := sql.NullInt64{Int64: int64(d.ResponseCode), Valid: d.ResponseCode != 0}
+	_, err = s.db.ExecContext(ctx, query,
+		d.Status, d.Attempts, d.NextAttemptAt, nullString(d.LastError), code, d.DeliveredAt, d.ID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error recording delivery attempt: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListDeliveries returns the latest deliveries of a webhook, newest first,
+// optionally only those with the given status.
+func (s *webhookRepo) ListDeliveries(ctx context.Context, webhookID, status string, limit int) (_ []*model.Delivery, err error) {
+	query := `SELECT ` + deliveryColumns + `
+		 FROM webhook_deliveries d JOIN outbox_events e ON e.id = d.event_id
+		 WHERE d.webhook_id = $1`
+	args := []any{webhookID}
+	if status != "" {
+		args = append(args, status)
+		query += " AND d.status = $" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	query += " ORDER BY d.created_at DESC LIMIT $" + strconv.Itoa(len(args))
+	ctx, end := startCall(ctx, "WebhookRepository", "ListDeliveries", query)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error listing deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*model.Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	setRows(ctx, len(out))
+
+	return out, nil
+}
+
+// Redeliver moves a dead delivery back to pending with a fresh set of
+// attempts and reports whether such a delivery existed.
+func (s *webhookRepo) Redeliver(ctx context.Context, webhookID, deliveryID string) (_ bool, err error) {
+	const query = `UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=now()
+		 WHERE id=$1 AND webhook_id=$2 AND status='dead'`
+	ctx, end := startCall(ctx, "WebhookRepository", "Redeliver", query)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, query, deliveryID, webhookID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Error requeueing delivery: %v", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/model"
+)
+
+// countEvents returns the number of outbox events of eventType about the
+// subscription id.
+func countEvents(t *testing.T, eventType, id string) int {
+	var n int
+	err := testDB.QueryRow(`SELECT count(*) FROM outbox_events WHERE event_type = $1 AND payload->>'id' = $2`,
+		eventType, id).Scan(&n)
+	if err != nil {
+		t.Fatalf("Counting events failed: %v", err)
+	}
+	return n
+}
+
+func TestOutboxDispatch(t *testing.T) {
+	hooks := NewWebhookRepo(testDB)
+	ctx := context.Background()
+
+	hook := &model.Webhook{
+		URL:       "https://example.com/hook",
+		Secret:    "shh",
+		Events:    []string{model.EventSubscriptionDeleted},
+		CreatedAt: time.Now(),
+	}
+	if err := hooks.Create(ctx, hook); err != nil {
+		t.Fatalf("Create webhook failed: %v", err)
+	}
+	defer hooks.Delete(ctx, hook.ID)
+
+	// Creating and deleting write their events in the same transaction.
+	sub := createTestSubscription(t)
+	if err := testRepo.Delete(ctx, sub.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	for {
+		events, _, err := hooks.Dispatch(ctx, 100)
+		if err != nil {
+			t.Fatalf("Dispatch failed: %v", err)
+		}
+		if events < 100 {
+			break
+		}
+	}
+
+	deliveries, err := hooks.ListDeliveries(ctx, hook.ID, model.DeliveryPending, 10)
+	if err != nil {
+		t.Fatalf("ListDeliveries failed: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Event.Type != model.EventSubscriptionDeleted {
+		t.Fatalf("Expected only the delete event to be queued, got %+v", deliveries)
+	}
+	var data model.Subscription
+	if err := json.Unmarshal(deliveries[0].Event.Data, &data); err != nil || data.ID != sub.ID {
+		t.Errorf("Expected the deleted subscription as payload, got %s", deliveries[0].Event.Data)
+	}
+
+	// A dead delivery can be sent again.
+	d := deliveries[0]
+	d.Status, d.Attempts = model.DeliveryDead, 8
+	if err := hooks.RecordAttempt(ctx, d); err != nil {
+		t.Fatalf("RecordAttempt failed: %v", err)
+	}
+	if ok, err := hooks.Redeliver(ctx, hook.ID, d.ID); err != nil || !ok {
+		t.Errorf("Redeliver failed: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package scheduler runs periodic background jobs. Every run takes a
+// Postgres advisory lock named after the job, so when several replicas run
+// the same schedule only one of them executes a given job at a time.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// Job is a unit of background work.
+type Job func(ctx context.Context) error
+
+type entry struct {
+	name     string
+	interval time.Duration
+	run      Job
+}
+
+type Scheduler struct {
+	db   *sql.DB
+	jobs []entry
+}
+
+func New(db *sql.DB) *Scheduler {
+	return &Scheduler{db: db}
+}
+
+// Add registers job to run every interval, starting immediately.
+func (s *Scheduler) Add(name string, interval time.Duration, job Job) {
+	s.jobs = append(s.jobs, entry{name: name, interval: interval, run: job})
+}
+
+// Run starts every job and blocks until ctx is done and all running jobs
+// have returned.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range s.jobs {
+		wg.Add(1)
+		go func(e entry) {
+			defer wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e entry) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx, e.name, e.run)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs job under the advisory lock for name. It returns false
+// without running the job when another session holds the lock.
+func (s *Scheduler) RunOnce(ctx context.Context, name string, job Job) bool {
+	entry := logger.L().WithFields(log.Fields{"job": name})
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		entry.Errorf("Failed to get a connection for job: %v", err)
+		return false
+	}
+	defer conn.Close()
+
+	key := lockKey(name)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		entry.Errorf("Failed to take job lock: %v", err)
+		return false
+	}
+	if !locked {
+		entry.Debug("Job is running on another replica, skipping")
+		return false
+	}
+	// Unlock on a fresh context so that shutdown does not leave the lock
+	// held until the connection is recycled.
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+
+	start := time.Now()
+	if err := job(ctx); err != nil {
+		entry.Errorf("Job failed after %s: %v", time.Since(start), err)
+		return true
+	}
+	entry.Debugf("Job finished in %s", time.Since(start))
+	return true
+}
+
+// lockKey maps a job name to an advisory lock key.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("subscription_service:" + name))
+	return int64(h.Sum64())
+}
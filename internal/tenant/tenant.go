@@ -0,0 +1,37 @@
+package tenant
+
+import (
+	"context"
+	"time"
+)
+
+type orgKey struct{}
+
+type locationKey struct{}
+
+// WithOrg returns a copy of ctx scoped to the given organization. Repository
+// queries made with the returned context only see that organization's rows.
+func WithOrg(ctx context.Context, orgID string) context.Context {
+	return context.WithValue(ctx, orgKey{}, orgID)
+}
+
+// OrgID returns the organization ctx is scoped to, or "" when the caller is
+// not limited to a tenant.
+func OrgID(ctx context.Context) string {
+	orgID, _ := ctx.Value(orgKey{}).(string)
+	return orgID
+}
+
+// WithLocation returns a copy of ctx whose calendar dates follow loc. The
+// zone package resolves loc; it is kept here so repositories can read it.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// Location returns the zone ctx's dates follow, UTC when none was set.
+func Location(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/Elmar006/subscription_service/internal/config"
+)
+
+// keepProvider restores the global tracer provider when the test ends.
+func keepProvider(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+}
+
+func TestInitNone(t *testing.T) {
+	keepProvider(t)
+
+	cfg := config.Default()
+	cfg.TracingExporter = "none"
+
+	shutdown, err := Init(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		t.Error("Expected no SDK tracer provider with the none exporter")
+	}
+}
+
+func TestInitStdout(t *testing.T) {
+	keepProvider(t)
+
+	cfg := config.Default()
+	cfg.TracingExporter = "stdout"
+
+	shutdown, err := Init(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); !ok {
+		t.Errorf("Expected an SDK tracer provider, got %T", otel.GetTracerProvider())
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	cfg := config.Default()
+	cfg.TracingExporter = "jaeger"
+
+	if _, err := Init(context.Background(), cfg); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}
+
+func TestMiddlewareNamesSpanAfterRoute(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	keepProvider(t)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/42", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected one span, got %d", len(spans))
+	}
+	if name := spans[0].Name(); name != "GET /subscriptions/{id}" {
+		t.Errorf("Expected span named after the route, got %q", name)
+	}
+	found := false
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key == "http.route" && attr.Value.AsString() == "/subscriptions/{id}" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected http.route attribute, got %v", spans[0].Attributes())
+	}
+}
@@ -0,0 +1,189 @@
+// Package webhook delivers the events written to the outbox to registered
+// webhook endpoints, signing each request and retrying failures with
+// exponential backoff until they succeed or are moved to the dead-letter
+// state.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/billing"
+	"github.com/Elmar006/subscription_service/internal/config"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// Headers set on every delivery. The signature header has the form
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">".
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-ID"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	batchSize   = 100
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+	dateLayout  = "2006-01-02"
+)
+
+// Sign returns the signature header value for body sent at ts.
+func Sign(secret string, ts time.Time, body []byte) string {
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "."))
+	mac.Write(body)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before the next try after the given
+// number of failed attempts: 30s, 1m, 2m and so on, at most an hour.
+func Backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+type Dispatcher struct {
+	repo        repository.WebhookRepository
+	subs        repository.SubscriptionRepository
+	client      *http.Client
+	maxAttempts int
+}
+
+func New(repo repository.WebhookRepository, subs repository.SubscriptionRepository, cfg config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		repo:        repo,
+		subs:        subs,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		maxAttempts: cfg.MaxAttempts,
+	}
+}
+
+// Run fans new outbox events out to the webhooks subscribed to them and
+// then makes one attempt at every delivery that is due.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		events, deliveries, err := d.repo.Dispatch(ctx, batchSize)
+		if err != nil {
+			return err
+		}
+		if deliveries > 0 {
+			logger.L().Infof("Queued %d webhook deliveries for %d events", deliveries, events)
+		}
+		if events < batchSize {
+			break
+		}
+	}
+
+	due, err := d.repo.Due(ctx, time.Now(), batchSize)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, o := range due {
+		if err := d.attempt(ctx, o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// attempt sends one delivery and records the outcome. Only failures to
+// record it are returned; a failed send is retried later.
+func (d *Dispatcher) attempt(ctx context.Context, o *repository.OutgoingDelivery) error {
+	code, err := d.send(ctx, o)
+
+	del := &o.Delivery
+	del.Attempts++
+	del.ResponseCode = code
+	now := time.Now()
+	switch {
+	case err == nil:
+		del.Status, del.LastError, del.DeliveredAt = model.DeliveryDelivered, "", &now
+	case del.Attempts >= d.maxAttempts:
+		del.Status, del.LastError = model.DeliveryDead, err.Error()
+		logger.L().Warnf("Webhook delivery %s is dead after %d attempts: %v", del.ID, del.Attempts, err)
+	default:
+		next := now.Add(Backoff(del.Attempts))
+		del.LastError, del.NextAttemptAt = err.Error(), &next
+	}
+	return d.repo.RecordAttempt(ctx, del)
+}
+
+// send posts the event to the webhook and returns the response status.
+func (d *Dispatcher) send(ctx context.Context, o *repository.OutgoingDelivery) (int, error) {
+	body, err := json.Marshal(o.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, o.Event.Type)
+	req.Header.Set(HeaderEventID, o.Event.ID)
+	req.Header.Set(HeaderSignature, Sign(o.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Charges writes a charge event to the outbox for every charge due on the
+// given day. Each charge is written once, however often this runs.
+func (d *Dispatcher) Charges(ctx context.Context, day time.Time) error {
+	subs, err := d.subs.ListBetween(ctx, nil, nil, day, day)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		for _, c := range billing.Charges(sub, day, day) {
+			date := model.DateOf(c.Date)
+			event := model.ChargeEvent{
+				SubscriptionID: sub.ID,
+				ServiceName:    sub.ServiceName,
+				UserID:         sub.UserID,
+				Date:           date,
+				Amount:         c.Amount,
+			}
+			key := "charge:" + sub.ID + ":" + string(date)
+			if _, err := d.repo.Enqueue(ctx, model.EventSubscriptionCharged, sub.OrgID, key, event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ChargesJob adapts Charges to the scheduler, using the current date.
+func (d *Dispatcher) ChargesJob(ctx context.Context) error {
+	today, _ := time.Parse(dateLayout, time.Now().Format(dateLayout))
+	return d.Charges(ctx, today)
+}
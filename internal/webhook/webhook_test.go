@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/config"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/repository"
+)
+
+// stubRepo serves one due delivery and keeps the recorded attempts.
+type stubRepo struct {
+	repository.WebhookRepository
+	due      []*repository.OutgoingDelivery
+	recorded []model.Delivery
+}
+
+func (s *stubRepo) Dispatch(ctx context.Context, limit int) (int, int, error) { return 0, 0, nil }
+
+func (s *stubRepo) Due(ctx context.Context, at time.Time, limit int) ([]*repository.OutgoingDelivery, error) {
+	return s.due, nil
+}
+
+func (s *stubRepo) RecordAttempt(ctx context.Context, d *model.Delivery) error {
+	s.recorded = append(s.recorded, *d)
+	return nil
+}
+
+func outgoing(url string, attempts int) *repository.OutgoingDelivery {
+	return &repository.OutgoingDelivery{
+		Delivery: model.Delivery{
+			ID:       "d1",
+			Status:   model.DeliveryPending,
+			Attempts: attempts,
+			Event:    model.Event{ID: "e1", Type: model.EventSubscriptionCreated, Data: []byte(`{"id":"s1"}`)},
+		},
+		URL:    url,
+		Secret: "shh",
+	}
+}
+
+func TestSign(t *testing.T) {
+	ts := time.Unix(1767225600, 0)
+	body := []byte(`{"id":"e1"}`)
+
+	mac := hmac.New(sha256.New, []byte("shh"))
+	mac.Write([]byte("1767225600." + string(body)))
+	want := "t=1767225600,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("shh", ts, body); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 20: time.Hour}
+	for attempts, want := range cases {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	repo := &stubRepo{due: []*repository.OutgoingDelivery{outgoing(srv.URL, 0)}}
+	d := New(repo, nil, config.WebhooksConfig{MaxAttempts: 3, Timeout: time.Second})
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(repo.recorded) != 1 || repo.recorded[0].Status != model.DeliveryDelivered || repo.recorded[0].Attempts != 1 {
+		t.Fatalf("Expected one delivered attempt, got %+v", repo.recorded)
+	}
+	if header.Get(HeaderEvent) != model.EventSubscriptionCreated || header.Get(HeaderEventID) != "e1" {
+		t.Errorf("Unexpected headers %v", header)
+	}
+	ts, _, _ := strings.Cut(strings.TrimPrefix(header.Get(HeaderSignature), "t="), ",")
+	unix, _ := strconv.ParseInt(ts, 10, 64)
+	if want := Sign("shh", time.Unix(unix, 0), body); header.Get(HeaderSignature) != want {
+		t.Errorf("Signature %s does not match body, want %s", header.Get(HeaderSignature), want)
+	}
+}
+
+func TestDeliverRetriesThenDies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	repo := &stubRepo{due: []*repository.OutgoingDelivery{outgoing(srv.URL, 0)}}
+	d := New(repo, nil, config.WebhooksConfig{MaxAttempts: 2, Timeout: time.Second})
+
+	d.Run(context.Background())
+	first := repo.recorded[0]
+	if first.Status != model.DeliveryPending || first.NextAttemptAt == nil || first.ResponseCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a pending retry, got %+v", first)
+	}
+
+	d.Run(context.Background())
+	if last := repo.recorded[1]; last.Status != model.DeliveryDead || last.Attempts != 2 || last.LastError == "" {
+		t.Errorf("Expected a dead delivery after two attempts, got %+v", last)
+	}
+}
@@ -0,0 +1,132 @@
+// Package zone decides which time zone "today" and month boundaries
+// follow. Dates are calendar dates without a zone; a request sees them in
+// the zone of the user it is about, or of its organization, or in UTC.
+//
+// Dates are represented as midnight UTC of the calendar day, the form the
+// billing package works with, so Today returns the local calendar date in
+// that form rather than a local instant.
+package zone
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/policy"
+	"github.com/Elmar006/subscription_service/internal/repository"
+	"github.com/Elmar006/subscription_service/internal/tenant"
+	"github.com/Elmar006/subscription_service/logger"
+)
+
+// WithLocation returns a context whose dates follow loc.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return tenant.WithLocation(ctx, loc)
+}
+
+// FromContext returns the zone of ctx, UTC when none was set.
+func FromContext(ctx context.Context) *time.Location {
+	return tenant.Location(ctx)
+}
+
+// Today returns the calendar date of now in loc as midnight UTC.
+func Today(now time.Time, loc *time.Location) time.Time {
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// TodayIn returns the current calendar date in the zone of ctx.
+func TodayIn(ctx context.Context) time.Time {
+	return Today(time.Now(), FromContext(ctx))
+}
+
+// Load returns the zone named name, UTC for an empty or unknown name.
+func Load(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Resolver looks up the zones of users and organizations.
+type Resolver struct {
+	users repository.UserRepository
+	orgs  repository.OrganizationRepository
+}
+
+func NewResolver(users repository.UserRepository, orgs repository.OrganizationRepository) *Resolver {
+	return &Resolver{users: users, orgs: orgs}
+}
+
+// Location returns the zone of userID, or of the organization ctx is
+// scoped to when userID is empty or unknown, or UTC.
+func (z *Resolver) Location(ctx context.Context, userID string) (*time.Location, error) {
+	return z.For(ctx, userID, tenant.OrgID(ctx))
+}
+
+// For returns the zone of userID, or of orgID when userID is empty or
+// unknown, or UTC.
+func (z *Resolver) For(ctx context.Context, userID, orgID string) (*time.Location, error) {
+	if userID != "" {
+		u, err := z.users.GetByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if u != nil {
+			return Load(u.Timezone), nil
+		}
+	}
+	if orgID != "" {
+		org, err := z.orgs.GetByID(ctx, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if org != nil {
+			return Load(org.Timezone), nil
+		}
+	}
+	return time.UTC, nil
+}
+
+// Middleware sets the zone of the request: that of the user named in the
+// user_id query parameter when pol lets the caller read that user's
+// subscriptions, else of the calling user, else of the organization. It
+// runs after auth.Tenant and the rate limiter, since it queries the
+// database.
+func (z *Resolver) Middleware(pol *policy.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := auth.FromContext(r.Context())
+			userID := r.URL.Query().Get("user_id")
+			if _, err := uuid.Parse(userID); err != nil || !mayRead(p, pol, userID) {
+				userID = ""
+				if p != nil {
+					userID = p.UserID
+				}
+			}
+
+			loc, err := z.Location(r.Context(), userID)
+			if err != nil {
+				logger.FromContext(r.Context()).Errorf("Failed to resolve time zone: %v", err)
+				loc = time.UTC
+			}
+			next.ServeHTTP(w, r.WithContext(WithLocation(r.Context(), loc)))
+		})
+	}
+}
+
+// mayRead reports whether p may read the subscriptions of userID under pol,
+// like the handlers decide it.
+func mayRead(p *auth.Principal, pol *policy.Policy, userID string) bool {
+	if p == nil {
+		return true
+	}
+	allowed, all := pol.Check(p.Roles, policy.ActionRead)
+	return allowed && (all || p.UserID == "" || p.UserID == userID)
+}
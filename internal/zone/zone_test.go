@@ -0,0 +1,85 @@
+package zone
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Elmar006/subscription_service/internal/auth"
+	"github.com/Elmar006/subscription_service/internal/model"
+	"github.com/Elmar006/subscription_service/internal/policy"
+	"github.com/Elmar006/subscription_service/internal/repository"
+)
+
+func TestToday(t *testing.T) {
+	now := time.Date(2026, 1, 31, 22, 30, 0, 0, time.UTC)
+	cases := []struct {
+		zone string
+		want string
+	}{
+		{"UTC", "2026-01-31"},
+		{"Europe/Moscow", "2026-02-01"},
+		{"America/Los_Angeles", "2026-01-31"},
+		{"Not/AZone", "2026-01-31"},
+	}
+	for _, c := range cases {
+		got := Today(now, Load(c.zone))
+		if got.Format("2006-01-02") != c.want || got.Location() != time.UTC || got.Hour() != 0 {
+			t.Errorf("Today in %s = %v, want %s at midnight UTC", c.zone, got, c.want)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != time.UTC {
+		t.Errorf("Expected UTC without a zone in the context")
+	}
+	loc := Load("Asia/Tokyo")
+	if FromContext(WithLocation(context.Background(), loc)) != loc {
+		t.Errorf("Expected the zone set in the context")
+	}
+}
+
+// zoneUsers serves users with a timezone from a map.
+type zoneUsers struct {
+	repository.UserRepository
+	zones map[string]string
+}
+
+func (u zoneUsers) GetByID(_ context.Context, id string) (*model.User, error) {
+	if tz, ok := u.zones[id]; ok {
+		return &model.User{ID: id, Timezone: tz}, nil
+	}
+	return nil, nil
+}
+
+func TestMiddlewareUserID(t *testing.T) {
+	const caller, other = "60601fee-2bf1-4721-ae6f-7636e79a0cba", "0a8b3c1e-5d2f-4e6a-9b7c-1d2e3f4a5b6c"
+	z := NewResolver(zoneUsers{zones: map[string]string{caller: "Europe/Moscow", other: "Asia/Tokyo"}}, nil)
+	pol, err := policy.New(policy.Default())
+	if err != nil {
+		t.Fatalf("Failed to build policy: %v", err)
+	}
+
+	cases := []struct {
+		roles []string
+		want  string
+	}{
+		{[]string{"viewer"}, "Europe/Moscow"},
+		{[]string{"finance"}, "Asia/Tokyo"},
+	}
+	for _, c := range cases {
+		var got string
+		h := z.Middleware(pol)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context()).String()
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/subscriptions/total?user_id="+other, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{UserID: caller, Roles: c.roles}))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got != c.want {
+			t.Errorf("Zone for %v = %s, want %s", c.roles, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen caps the length of a client-supplied request ID.
+const maxRequestIDLen = 64
+
+type fieldsKey struct{}
+
+// RequestID takes the request ID from the X-Request-ID header or generates
+// a new one when the header is missing, too long or contains characters
+// outside [A-Za-z0-9-_.:]. The ID is echoed back in the response and
+// stored in the request context. It is stored under chi's key as well, so
+// middleware.Logger prints it next to each access log line.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(reqID) {
+			reqID = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, reqID)
+
+		ctx := context.WithValue(r.Context(), middleware.RequestIDKey, reqID)
+		ctx = WithFields(ctx, log.Fields{"request_id": reqID})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithFields returns a copy of ctx whose logger carries the given fields
+// in addition to the ones already stored in ctx.
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	merged := log.Fields{}
+	if parent, ok := ctx.Value(fieldsKey{}).(log.Fields); ok {
+		for k, v := range parent {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FromContext returns a log entry with the fields stored in ctx. When the
+// request has been routed by chi, the route pattern is added as well.
+func FromContext(ctx context.Context) *log.Entry {
+	entry := log.NewEntry(L())
+	if fields, ok := ctx.Value(fieldsKey{}).(log.Fields); ok {
+		entry = entry.WithFields(fields)
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+		entry = entry.WithField("route", rctx.RoutePattern())
+	}
+	return entry
+}
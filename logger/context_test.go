@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestWithFieldsMergesParentFields(t *testing.T) {
+	ctx := WithFields(context.Background(), log.Fields{"request_id": "abc"})
+	ctx = WithFields(ctx, log.Fields{"user_id": "u1"})
+
+	entry := FromContext(ctx)
+	if entry.Data["request_id"] != "abc" || entry.Data["user_id"] != "u1" {
+		t.Errorf("Expected request_id and user_id fields, got %v", entry.Data)
+	}
+}
+
+func TestRequestIDReusesHeader(t *testing.T) {
+	var got interface{}
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context()).Data["request_id"]
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got != "req-42" {
+		t.Errorf("Expected request_id req-42 in context, got %v", got)
+	}
+	if w.Header().Get(RequestIDHeader) != "req-42" {
+		t.Errorf("Expected request ID to be echoed, got %q", w.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestRequestIDReplacesUnsafeHeader(t *testing.T) {
+	for _, header := range []string{
+		"bad id\nwith newline",
+		"<script>",
+		strings.Repeat("a", maxRequestIDLen+1),
+	} {
+		var got interface{}
+		h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context()).Data["request_id"]
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set(RequestIDHeader, header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		echoed := w.Header().Get(RequestIDHeader)
+		if echoed == header || got != echoed {
+			t.Errorf("Expected a generated request ID for %q, got %v (echoed %q)", header, got, echoed)
+		}
+		if _, err := uuid.Parse(echoed); err != nil {
+			t.Errorf("Expected a UUID request ID, got %q", echoed)
+		}
+	}
+}
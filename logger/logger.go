@@ -6,7 +6,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func Init() {
+// Init configures the standard logger. level comes from config.Config and
+// has already been validated there.
+func Init(level string) {
 	log.SetOutput(os.Stdout)
 
 	if os.Getenv("APP_ENV") == "prod" {
@@ -16,6 +18,9 @@ func Init() {
 	}
 
 	log.SetLevel(log.InfoLevel)
+	if lvl, err := log.ParseLevel(level); err == nil {
+		log.SetLevel(lvl)
+	}
 	if os.Getenv("APP_ENV") == "dev" {
 		log.SetFormatter(&log.TextFormatter{
 			FullTimestamp: true,
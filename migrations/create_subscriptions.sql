@@ -14,3 +14,285 @@ CREATE TABLE IF NOT EXISTS subscriptions (
 CREATE INDEX IF NOT EXISTS idx_sub_user_id ON subscriptions(user_id);
 CREATE INDEX IF NOT EXISTS idx_sub_service_name ON subscriptions(service_name);
 CREATE INDEX IF NOT EXISTS idx_sub_start_date ON subscriptions(start_date);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS org_members (
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'head')),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_members_user_id ON org_members(user_id);
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS org_id UUID REFERENCES organizations(id);
+CREATE INDEX IF NOT EXISTS idx_sub_org_id ON subscriptions(org_id);
+
+
+CREATE TABLE IF NOT EXISTS services (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL,
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    category TEXT,
+    vendor_url TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_services_name ON services(lower(name));
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS service_id UUID REFERENCES services(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_sub_service_id ON subscriptions(service_id);
+-- Subscriptions created before their catalog entry are linked to it.
+UPDATE subscriptions s SET service_id = sv.id, service_name = sv.name
+    FROM services sv
+    WHERE s.service_id IS NULL AND (lower(sv.name) = lower(trim(s.service_name))
+        OR lower(trim(s.service_name)) = ANY(SELECT lower(a) FROM unnest(sv.aliases) a));
+
+CREATE TABLE IF NOT EXISTS plans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    price INTEGER NOT NULL CHECK (price > 0),
+    billing_period TEXT NOT NULL DEFAULT 'monthly' CHECK (billing_period IN ('monthly', 'quarterly', 'yearly')),
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plans_service_name ON plans(service_id, lower(name));
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS plan_id UUID REFERENCES plans(id) ON DELETE SET NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS billing_period TEXT NOT NULL DEFAULT 'monthly'
+    CHECK (billing_period IN ('monthly', 'quarterly', 'yearly'));
+CREATE INDEX IF NOT EXISTS idx_sub_plan_id ON subscriptions(plan_id);
+
+CREATE TABLE IF NOT EXISTS price_changes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    price INTEGER NOT NULL CHECK (price > 0),
+    effective_date DATE NOT NULL,
+    applied_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_changes_pending ON price_changes(effective_date) WHERE applied_at IS NULL;
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS trial_end_date DATE;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS intro_price INTEGER CHECK (intro_price >= 0);
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS intro_months INTEGER NOT NULL DEFAULT 0 CHECK (intro_months >= 0);
+CREATE INDEX IF NOT EXISTS idx_sub_trial_end_date ON subscriptions(trial_end_date) WHERE trial_end_date IS NOT NULL;
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'paused', 'cancelled'));
+
+CREATE TABLE IF NOT EXISTS subscription_transitions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    effective_date DATE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transitions_subscription_id ON subscription_transitions(subscription_id, created_at);
+
+CREATE TABLE IF NOT EXISTS reminders_sent (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    due_date DATE NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (subscription_id, kind, due_date)
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    org_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Transactional outbox: events are written in the same transaction as the
+-- subscription change and fanned out to webhook_deliveries afterwards.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    org_id UUID,
+    dedup_key TEXT UNIQUE,
+    dispatched_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox_events(created_at) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL REFERENCES outbox_events(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_error TEXT,
+    response_code INTEGER,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+
+CREATE TABLE IF NOT EXISTS budgets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID,
+    org_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    service_name TEXT,
+    category TEXT,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK (user_id IS NOT NULL OR org_id IS NOT NULL),
+    CHECK (service_name IS NULL OR category IS NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_budgets_user_id ON budgets(user_id);
+CREATE INDEX IF NOT EXISTS idx_budgets_org_id ON budgets(org_id);
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS category TEXT;
+UPDATE subscriptions s SET category = lower(sv.category)
+    FROM services sv
+    WHERE s.service_id = sv.id AND s.category IS NULL AND sv.category IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_sub_category ON subscriptions(category);
+
+CREATE TABLE IF NOT EXISTS subscription_tags (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (subscription_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_tags_tag ON subscription_tags(tag);
+
+CREATE TABLE IF NOT EXISTS subscription_members (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    position INTEGER NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 0 CHECK (weight >= 0),
+    amount INTEGER CHECK (amount >= 0),
+    PRIMARY KEY (subscription_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_members_user_id ON subscription_members(user_id);
+
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL DEFAULT '',
+    email TEXT UNIQUE,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    currency TEXT NOT NULL DEFAULT 'RUB',
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Users that only existed as user_id of their subscriptions.
+INSERT INTO users (id) SELECT DISTINCT user_id FROM subscriptions ON CONFLICT DO NOTHING;
+INSERT INTO users (id) SELECT DISTINCT user_id FROM subscription_members ON CONFLICT DO NOTHING;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'subscriptions_user_id_fkey') THEN
+        ALTER TABLE subscriptions ADD CONSTRAINT subscriptions_user_id_fkey
+            FOREIGN KEY (user_id) REFERENCES users(id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'subscription_members_user_id_fkey') THEN
+        ALTER TABLE subscription_members ADD CONSTRAINT subscription_members_user_id_fkey
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
+-- Budgets and organization memberships go with their user.
+INSERT INTO users (id) SELECT DISTINCT user_id FROM budgets WHERE user_id IS NOT NULL ON CONFLICT DO NOTHING;
+INSERT INTO users (id) SELECT DISTINCT user_id FROM org_members ON CONFLICT DO NOTHING;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'budgets_user_id_fkey') THEN
+        ALTER TABLE budgets ADD CONSTRAINT budgets_user_id_fkey
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'org_members_user_id_fkey') THEN
+        ALTER TABLE org_members ADD CONSTRAINT org_members_user_id_fkey
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- Amounts are stored in minor units of the currency of their row, kopecks
+-- for RUB. Rows written before carried whole units in the user's currency.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS currency TEXT;
+UPDATE subscriptions s SET currency = u.currency FROM users u WHERE s.user_id = u.id AND s.currency IS NULL;
+UPDATE subscriptions SET currency = 'RUB' WHERE currency IS NULL;
+ALTER TABLE subscriptions ALTER COLUMN currency SET DEFAULT 'RUB', ALTER COLUMN currency SET NOT NULL;
+
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'RUB';
+
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS currency TEXT;
+UPDATE budgets b SET currency = u.currency FROM users u WHERE b.user_id = u.id AND b.currency IS NULL;
+UPDATE budgets SET currency = 'RUB' WHERE currency IS NULL;
+ALTER TABLE budgets ALTER COLUMN currency SET DEFAULT 'RUB', ALTER COLUMN currency SET NOT NULL;
+
+CREATE OR REPLACE FUNCTION minor_units(currency TEXT) RETURNS INTEGER AS $$
+    SELECT CASE
+        WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 0
+        WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 3
+        ELSE 2
+    END
+$$ LANGUAGE SQL IMMUTABLE;
+
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'subscriptions' AND column_name = 'price') = 'integer' THEN
+        ALTER TABLE subscriptions ALTER COLUMN price TYPE BIGINT, ALTER COLUMN intro_price TYPE BIGINT;
+        UPDATE subscriptions SET price = price * (10 ^ minor_units(currency))::BIGINT,
+            intro_price = intro_price * (10 ^ minor_units(currency))::BIGINT;
+
+        ALTER TABLE plans ALTER COLUMN price TYPE BIGINT;
+        UPDATE plans SET price = price * (10 ^ minor_units(currency))::BIGINT;
+
+        ALTER TABLE budgets ALTER COLUMN amount TYPE BIGINT;
+        UPDATE budgets SET amount = amount * (10 ^ minor_units(currency))::BIGINT;
+
+        ALTER TABLE price_changes ALTER COLUMN price TYPE BIGINT;
+        UPDATE price_changes pc SET price = pc.price * (10 ^ minor_units(s.currency))::BIGINT
+            FROM subscriptions s WHERE pc.subscription_id = s.id;
+
+        ALTER TABLE subscription_members ALTER COLUMN amount TYPE BIGINT;
+        UPDATE subscription_members m SET amount = m.amount * (10 ^ minor_units(s.currency))::BIGINT
+            FROM subscriptions s WHERE m.subscription_id = s.id;
+    END IF;
+END $$;
+
+-- Applied price changes keep the price they replaced so that earlier
+-- charges keep their price. For changes applied before, it is the price of
+-- the change before them; what the first one replaced is unknown.
+ALTER TABLE price_changes ADD COLUMN IF NOT EXISTS previous_price BIGINT;
+UPDATE price_changes pc SET previous_price = prev.price
+    FROM (SELECT id, lag(price) OVER (PARTITION BY subscription_id ORDER BY effective_date, created_at) AS price
+          FROM price_changes WHERE applied_at IS NOT NULL) prev
+    WHERE pc.id = prev.id AND pc.previous_price IS NULL AND prev.price IS NOT NULL;
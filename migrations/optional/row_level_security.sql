@@ -0,0 +1,19 @@
+-- Optional defence in depth for multi-tenant deployments.
+-- Apply manually after create_subscriptions.sql and start the service with
+-- FEATURES=rls. The service then sets app.org_id in every transaction and
+-- Postgres hides rows of other organizations even if a query forgets the
+-- tenant filter. Superusers bypass RLS, so connect as a regular role.
+
+ALTER TABLE subscriptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscriptions FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON subscriptions;
+CREATE POLICY tenant_isolation ON subscriptions
+    USING (
+        COALESCE(current_setting('app.org_id', true), '') = ''
+        OR org_id = current_setting('app.org_id', true)::uuid
+    )
+    WITH CHECK (
+        COALESCE(current_setting('app.org_id', true), '') = ''
+        OR org_id = current_setting('app.org_id', true)::uuid
+    );